@@ -2,13 +2,17 @@ package server
 
 import (
 	"auction-system/internal/gateway/sse"
+	"auction-system/pkg/models"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // mandatory headers for sse
@@ -52,7 +56,8 @@ func (s *Server) CreateAuction(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	// repassa a resposta do msleilao, que traz o ID do leilão criado
+	c.Data(http.StatusOK, "application/json", body)
 }
 
 func (s *Server) ConsultAuctions(c *gin.Context) {
@@ -83,30 +88,131 @@ func (s *Server) ConsultAuctions(c *gin.Context) {
 	c.JSON(http.StatusOK, auctions)
 }
 
+// PlaceBid repassa o lance com o cabeçalho Idempotency-Key, para que uma
+// retentativa do cliente receba o resultado original em vez de um lance duplicado
 func (s *Server) PlaceBid(c *gin.Context) {
-	makeBidReq, err := http.NewRequest("POST", fmt.Sprintf("http://%s/make-bid", s.msLanceHost), c.Request.Body)
+	s.forward(c, http.MethodPost, fmt.Sprintf("http://%s/make-bid", s.msLanceHost))
+}
+
+// SubmitBid publica o lance na fila lance.realizado em vez de chamar o mslance
+// por HTTP, então o lance não se perde se o mslance estiver reiniciando. A
+// resposta espera o resultado por até bidReplyTimeout; depois disso devolve
+// 202 e o resultado chega pelo stream do leilão
+func (s *Server) SubmitBid(c *gin.Context) {
+	var bidReq models.BidRequest
+	if err := c.ShouldBindJSON(&bidReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad bid format"})
+		return
+	}
+
+	bid, err := bidReq.Lance(c.GetHeader("Idempotency-Key"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// o bid_id é o correlation id da resposta e protege a reentrega da fila
+	if bid.BidID == "" {
+		bid.BidID = uuid.NewString()
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.bidReplyTimeout)
+	defer cancel()
+
+	resultado, err := s.rabbitConsumer.PublishBid(ctx, bid)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "bid_id": bid.BidID})
+		return
+	}
+
+	status := http.StatusOK
+	switch resultado.Status {
+	case models.LanceEnfileirado:
+		status = http.StatusAccepted
+	case models.LanceRecusado:
+		status = http.StatusUnprocessableEntity
+	case models.LanceConflito:
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, resultado)
+}
+
+func (s *Server) UpdateAuction(c *gin.Context) {
+	s.proxy(c, http.MethodPatch, fmt.Sprintf("http://%s/auctions/%s", s.msLeilaoHost, c.Param("id")))
+}
+
+func (s *Server) CancelAuction(c *gin.Context) {
+	s.proxy(c, http.MethodDelete, fmt.Sprintf("http://%s/auctions/%s", s.msLeilaoHost, c.Param("id")))
+}
+
+func (s *Server) BuyNow(c *gin.Context) {
+	s.proxy(c, http.MethodPost, fmt.Sprintf("http://%s/auctions/%s/buy-now", s.msLanceHost, c.Param("id")))
+}
+
+func (s *Server) GetBidHistory(c *gin.Context) {
+	s.proxy(c, http.MethodGet, fmt.Sprintf("http://%s/auctions/%s/bids?%s", s.msLanceHost, c.Param("id"), c.Request.URL.RawQuery))
+}
+
+func (s *Server) ListCreditPacks(c *gin.Context) {
+	s.forward(c, http.MethodGet, fmt.Sprintf("http://%s/credit-packs", s.msPagHost))
+}
+
+func (s *Server) BuyCredits(c *gin.Context) {
+	s.forward(c, http.MethodPost, fmt.Sprintf("http://%s/credit-packs", s.msPagHost))
+}
+
+func (s *Server) GetCredits(c *gin.Context) {
+	s.forward(c, http.MethodGet, fmt.Sprintf("http://%s/credits/%s", s.msLanceHost, url.PathEscape(c.Param("userId"))))
+}
+
+// proxy valida o id do leilão na rota antes de repassar a requisição
+func (s *Server) proxy(c *gin.Context, method string, url string) {
+	if err := models.ValidateAuctionID(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.forward(c, method, url)
+}
+
+// forward repassa a requisição como veio e devolve a resposta do microsserviço
+// sem alterações
+func (s *Server) forward(c *gin.Context, method string, url string) {
+	req, err := http.NewRequest(method, url, c.Request.Body)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create request: %v", err)})
 		return
 	}
 
-	makeBidReq.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if token := c.GetHeader("X-Admin-Token"); token != "" {
+		req.Header.Set("X-Admin-Token", token)
+	}
 
-	makeBidResp, err := http.DefaultClient.Do(makeBidReq)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get response: %s", err.Error())})
 		return
 	}
-	defer makeBidResp.Body.Close()
+	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(makeBidResp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read response"})
+		return
+	}
 
-	if makeBidResp.StatusCode != http.StatusOK {
-		c.JSON(makeBidResp.StatusCode, gin.H{"error": string(body)})
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		c.JSON(resp.StatusCode, gin.H{"error": string(body)})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	c.JSON(resp.StatusCode, result)
 }
 
 func (s *Server) RegisterInterest(c *gin.Context) {
@@ -122,7 +228,7 @@ func (s *Server) RegisterInterest(c *gin.Context) {
 		return
 	}
 
-	log.Printf("🔌 Cliente %s iniciou stream no leilão %d", client.ID, client.LeilaoID)
+	log.Printf("🔌 Cliente %s iniciou stream no leilão %s", client.ID, client.LeilaoID)
 
 	// Iniciar stream
 	c.Stream(func(w io.Writer) bool {
@@ -163,6 +269,11 @@ func (s *Server) GetHighestBid(c *gin.Context) {
 		return
 	}
 
+	if err := models.ValidateAuctionID(auctionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	url := fmt.Sprintf("http://%s/highest-bid?auctionId=%s", s.msLanceHost, auctionID)
 	resp, err := http.Get(url)
 	if err != nil {
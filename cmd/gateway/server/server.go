@@ -16,17 +16,31 @@ type Server struct {
 	port           int
 	msLanceHost    string
 	msLeilaoHost   string
+	msPagHost      string
 	eventStream    *sse.EventStream
 	rabbitConsumer *rabbitmq.RabbitMQConsumer
+	// bidReplyTimeout é quanto POST /bids espera a resposta do mslance
+	bidReplyTimeout time.Duration
 }
 
 func NewServer() (*http.Server, error) {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
 	msLeilao := os.Getenv("MSLEILAO_HOST")
 	msLance := os.Getenv("MSLANCE_HOST")
+	msPag := os.Getenv("MSPAGAMENTO_HOST")
 	rabbitURL := os.Getenv("RABBITMQ_URL")
 
-	newStream := sse.NewEventStream()
+	bidReplyTimeout := 5 * time.Second
+	if v := os.Getenv("BID_REPLY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BID_REPLY_TIMEOUT: %w", err)
+		}
+		bidReplyTimeout = d
+	}
+
+	// ADMIN_TOKEN libera os IDs reais dos participantes nos eventos do leilão
+	newStream := sse.NewEventStream(os.Getenv("ADMIN_TOKEN"))
 
 	rabbitConsumer, err := rabbitmq.NewRabbitMQConsumer(rabbitURL, newStream)
 	if err != nil {
@@ -42,8 +56,11 @@ func NewServer() (*http.Server, error) {
 		port:           port,
 		msLanceHost:    msLance,
 		msLeilaoHost:   msLeilao,
+		msPagHost:      msPag,
 		eventStream:    newStream,
 		rabbitConsumer: rabbitConsumer,
+
+		bidReplyTimeout: bidReplyTimeout,
 	}
 
 	server := &http.Server{
@@ -62,8 +79,8 @@ func (s *Server) registerRoutes() http.Handler {
 
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "http://localhost:5173")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, X-Admin-Token")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -80,6 +97,14 @@ func (s *Server) registerRoutes() http.Handler {
 	r.GET("/highest-bid", s.GetHighestBid)
 	r.POST("/create-auction", s.CreateAuction)
 	r.POST("/make-bid", s.PlaceBid)
+	r.POST("/bids", s.SubmitBid)
+	r.PATCH("/auctions/:id", s.UpdateAuction)
+	r.DELETE("/auctions/:id", s.CancelAuction)
+	r.POST("/auctions/:id/buy-now", s.BuyNow)
+	r.GET("/auctions/:id/bids", s.GetBidHistory)
+	r.GET("/credit-packs", s.ListCreditPacks)
+	r.POST("/credit-packs", s.BuyCredits)
+	r.GET("/credits/:userId", s.GetCredits)
 
 	return r
 }
@@ -14,8 +14,19 @@ func main() {
 	defer conn.Close()
 	defer ch.Close()
 
-	server := server.NewServer(ch)
-	err := server.ListenAndServe()
+	// os lances têm o próprio canal, com um prefetch que não afeta os outros consumidores
+	intake, err := conn.Channel()
+	if err != nil {
+		panic(fmt.Sprintf("failed to open intake channel: %s", err))
+	}
+	defer intake.Close()
+
+	server, err := server.NewServer(ch, intake)
+	if err != nil {
+		panic(fmt.Sprintf("failed to start mslance: %s", err))
+	}
+
+	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("http server error: %s", err))
 	}
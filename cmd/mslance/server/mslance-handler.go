@@ -1,7 +1,10 @@
 package server
 
 import (
+	"auction-system/internal/mslance"
 	"auction-system/pkg/models"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -10,32 +13,42 @@ import (
 )
 
 func (s *Server) MakeBid(c *gin.Context) {
-	var bidReq struct {
-		UserID   string `json:"user_id"`
-		LeilaoID string `json:"leilao_id"`
-		Valor    string `json:"valor"`
-	}
-
+	var bidReq models.BidRequest
 	if err := c.ShouldBindJSON(&bidReq); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "bad bid format"})
 		return
 	}
 
-	valueNum, err := strconv.ParseFloat(bidReq.Valor, 64)
+	bid, err := bidReq.Lance(c.GetHeader("Idempotency-Key"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "value must be a number"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	bid := models.LanceRealizado{
-		UserID:   bidReq.UserID,
-		LeilaoID: bidReq.LeilaoID,
-		Valor:    valueNum,
+	result, err := s.msLance.MakeBid(bid)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, mslance.ErrBidIDReused) {
+			status = http.StatusConflict
+		}
+		resp := gin.H{
+			"error":    err.Error(),
+			"bid_id":   result.BidID,
+			"replayed": result.Replayed,
+		}
+		var rej *mslance.Rejeicao
+		if errors.As(err, &rej) {
+			resp["code"] = rej.Codigo
+		}
+		c.JSON(status, resp)
+		return
 	}
 
-	auctions := s.msLance.MakeBid(bid)
-
-	c.JSON(http.StatusOK, auctions)
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "accepted",
+		"bid_id":   result.BidID,
+		"replayed": result.Replayed,
+	})
 }
 
 func (s *Server) GetHighestBid(c *gin.Context) {
@@ -47,6 +60,11 @@ func (s *Server) GetHighestBid(c *gin.Context) {
 		return
 	}
 
+	if err := models.ValidateAuctionID(auctionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	highestBid, err := s.msLance.GetHighestBid(auctionID)
 	if err != nil {
 		statusCode := http.StatusInternalServerError
@@ -64,8 +82,118 @@ func (s *Server) GetHighestBid(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"auction_id":  auctionID,
-		"highest_bid": highestBid,
+		"highest_bid": highestBid.MaiorLance,
+		"end":         highestBid.Fim,
+	}
+	// no leilão reverso highest_bid é o menor lance e o próximo precisa ficar
+	// abaixo dele; next_maximum_bid é null quando nenhum lance cabe mais
+	if highestBid.Reverso {
+		resp["next_maximum_bid"] = nil
+		if highestBid.ProximoLanceMaximo.IsPositive() {
+			resp["next_maximum_bid"] = highestBid.ProximoLanceMaximo
+		}
+	} else {
+		resp["next_minimum_bid"] = highestBid.ProximoLanceMinimo
+	}
+	if highestBid.BuyNowPrice.IsPositive() {
+		resp["buy_now_price"] = highestBid.BuyNowPrice
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) BuyNow(c *gin.Context) {
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	auctionID := c.Param("id")
+	if err := models.ValidateAuctionID(auctionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.msLance.BuyNow(auctionID, req.UserID); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, mslance.ErrAuctionNotFound) {
+			status = http.StatusNotFound
+		}
+		resp := gin.H{"error": err.Error()}
+		var rej *mslance.Rejeicao
+		if errors.As(err, &rej) {
+			resp["code"] = rej.Codigo
+		}
+		c.JSON(status, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (s *Server) GetCredits(c *gin.Context) {
+	userID := c.Param("userId")
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"credits": s.msLance.Creditos(userID),
+	})
+}
+
+// GetBidHistory devolve o histórico paginado do leilão, do lance mais novo para
+// o mais antigo. Os participantes aparecem só pelo pseudônimo; com o
+// X-Admin-Token vêm os IDs reais
+func (s *Server) GetBidHistory(c *gin.Context) {
+	auctionID := c.Param("id")
+	if err := models.ValidateAuctionID(auctionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 100"})
+		return
+	}
+
+	bids, total, err := s.msLance.BidHistory(auctionID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, mslance.ErrHistorySealed) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !s.isAdmin(c) {
+		for i := range bids {
+			bids[i] = bids[i].Anonimizado()
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"auction_id": auctionID,
+		"bids":       bids,
+		"page":       page,
+		"page_size":  pageSize,
+		"total":      total,
 	})
 }
+
+func (s *Server) isAdmin(c *gin.Context) bool {
+	token := c.GetHeader("X-Admin-Token")
+	return s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
@@ -2,7 +2,12 @@ package server
 
 import (
 	"auction-system/internal/mslance"
+	"auction-system/pkg/clock"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -12,13 +17,54 @@ import (
 
 type Server struct {
 	msLance *mslance.MSLance
+	// adminToken libera os IDs reais no histórico de lances; vazio, ninguém os
+	// vê. Vem do mesmo ADMIN_TOKEN do gateway
+	adminToken string
 }
 
-func NewServer(ch *amqp.Channel) *http.Server {
-	msLance := mslance.NewMSLance(ch)
+// NewServer sobe o mslance. ch é usado pelos eventos de leilão e pelas
+// publicações; intake é o canal só dos lances vindos do gateway
+func NewServer(ch, intake *amqp.Channel) (*http.Server, error) {
+	bidsFile := os.Getenv("MSLANCE_BIDS_FILE")
+	if bidsFile == "" {
+		bidsFile = "data/mslance/bids.jsonl"
+	}
+
+	history, err := mslance.NewFileBidHistory(bidsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bid history: %w", err)
+	}
+
+	stateFile := os.Getenv("MSLANCE_STATE_FILE")
+	if stateFile == "" {
+		stateFile = "data/mslance/state.jsonl"
+	}
+
+	store, err := mslance.NewFileStateStore(stateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store: %w", err)
+	}
+
+	msLeilaoHost := os.Getenv("MSLEILAO_HOST")
+	if msLeilaoHost == "" {
+		msLeilaoHost = "localhost:8081"
+	}
+
+	msLance := mslance.NewMSLance(ch, clock.New(), history, store)
+
+	// usuários separados por vírgula, impedidos de dar lances
+	var bloqueados []string
+	for _, id := range strings.Split(os.Getenv("MSLANCE_BLOCKED_USERS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			bloqueados = append(bloqueados, id)
+		}
+	}
+	msLance.SetBidRules(mslance.DefaultBidRules(bloqueados))
+	msLance.SetBuyNowRules(mslance.DefaultBuyNowRules(bloqueados))
 
 	NewServer := &Server{
-		msLance: msLance,
+		msLance:    msLance,
+		adminToken: os.Getenv("ADMIN_TOKEN"),
 	}
 
 	server := &http.Server{
@@ -30,10 +76,18 @@ func NewServer(ch *amqp.Channel) *http.Server {
 	}
 
 	msLance.DeclareExchangeAndQueues()
+	if err := msLance.Recover(msLeilaoHost, os.Getenv("MSLEILAO_INTERNAL_TOKEN")); err != nil {
+		log.Printf("Recuperação incompleta, seguindo com o estado local: %v", err)
+	}
 	msLance.ListenLeilaoIniciado()
 	msLance.ListenLeilaoFinalizado()
+	msLance.ListenLeilaoCancelado()
+	msLance.ListenLeilaoAtualizado()
+	msLance.ListenLeilaoPrecoAtualizado()
+	msLance.ListenCreditosAdquiridos()
+	msLance.ListenLanceRealizado(intake)
 
-	return server
+	return server, nil
 }
 
 func (s *Server) registerRoutes() http.Handler {
@@ -42,12 +96,15 @@ func (s *Server) registerRoutes() http.Handler {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type"},
+		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-Admin-Token", "Idempotency-Key"},
 		AllowCredentials: true, // Enable cookies/auth
 	}))
 
 	r.POST("/make-bid", s.MakeBid)
 	r.GET("/highest-bid", s.GetHighestBid)
+	r.GET("/credits/:userId", s.GetCredits)
+	r.POST("/auctions/:id/buy-now", s.BuyNow)
+	r.GET("/auctions/:id/bids", s.GetBidHistory)
 
 	return r
 }
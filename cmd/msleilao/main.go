@@ -14,9 +14,13 @@ func main() {
 	defer conn.Close()
 	defer ch.Close()
 
-	server := server.NewServer(ch)
+	server, err := server.NewServer(ch)
+	if err != nil {
+		fmt.Printf("error starting server: %s", err.Error())
+		return
+	}
 
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("http server error: %s", err))
 	}
@@ -1,6 +1,11 @@
 package server
 
 import (
+	"auction-system/internal/msleilao"
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -14,11 +19,53 @@ func (s *Server) ConsultAuctions(c *gin.Context) {
 	c.JSON(http.StatusOK, auctions)
 }
 
+// requireInternalToken barra quem não apresenta o X-Internal-Token
+func (s *Server) requireInternalToken(c *gin.Context) {
+	token := c.GetHeader("X-Internal-Token")
+	if s.internalToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.internalToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "internal route"})
+		return
+	}
+	c.Next()
+}
+
+// OpenAuctions é usada pelo mslance para recuperar os leilões em andamento
+// quando sobe. Não passa pelo gateway
+func (s *Server) OpenAuctions(c *gin.Context) {
+	abertos, err := s.msLeilao.OpenAuctions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, abertos)
+}
+
 func (s *Server) CreateAuction(c *gin.Context) {
 	var newAuction struct {
-		Descricao string `json:"description"`
-		Inicio    string `json:"start"`
-		Fim       string `json:"end"`
+		Descricao     string                `json:"description"`
+		Inicio        string                `json:"start"`
+		Fim           string                `json:"end"`
+		ReservePrice  money.Money           `json:"reserve_price"`
+		StartingPrice money.Money           `json:"starting_price"`
+		Increments    models.IncrementTable `json:"increments"`
+
+		SoftCloseWindow    int `json:"soft_close_window"`
+		SoftCloseExtension int `json:"soft_close_extension"`
+
+		Tipo  models.AuctionType  `json:"type"`
+		Dutch *models.DutchParams `json:"dutch"`
+
+		Quantidade   int         `json:"quantity"`
+		CeilingPrice money.Money `json:"ceiling_price"`
+
+		Penny *models.PennyParams `json:"penny"`
+
+		BuyNowPrice     money.Money `json:"buy_now_price"`
+		BuyNowThreshold money.Money `json:"buy_now_threshold"`
+
+		SellerID       string `json:"seller_id"`
+		MaxBidsPerUser int    `json:"max_bids_per_user"`
 	}
 
 	if err := c.ShouldBindJSON(&newAuction); err != nil {
@@ -44,10 +91,133 @@ func (s *Server) CreateAuction(c *gin.Context) {
 		return
 	}
 
-	if err := s.msLeilao.CreateAuction(newAuction.Descricao, inicio, fim); err != nil {
+	params := msleilao.AuctionParams{
+		Descricao:     newAuction.Descricao,
+		Inicio:        inicio,
+		Fim:           fim,
+		ReservePrice:  newAuction.ReservePrice,
+		StartingPrice: newAuction.StartingPrice,
+		Increments:    newAuction.Increments,
+
+		SoftCloseWindow:    newAuction.SoftCloseWindow,
+		SoftCloseExtension: newAuction.SoftCloseExtension,
+
+		Tipo:  newAuction.Tipo,
+		Dutch: newAuction.Dutch,
+
+		Quantidade:   newAuction.Quantidade,
+		CeilingPrice: newAuction.CeilingPrice,
+
+		Penny: newAuction.Penny,
+
+		BuyNowPrice:     newAuction.BuyNowPrice,
+		BuyNowThreshold: newAuction.BuyNowThreshold,
+
+		SellerID:       newAuction.SellerID,
+		MaxBidsPerUser: newAuction.MaxBidsPerUser,
+	}
+
+	auction, err := s.msLeilao.CreateAuction(params)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("error creating auction: %s", err.Error())})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"status": "success", "id": auction.ID})
+}
+
+func (s *Server) UpdateAuction(c *gin.Context) {
+	var req struct {
+		Descricao *string `json:"description"`
+		Inicio    *string `json:"start"`
+		Fim       *string `json:"end"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad auction format"})
+		return
+	}
+
+	upd := msleilao.AuctionUpdate{Descricao: req.Descricao}
+
+	if req.Inicio != nil {
+		inicio, err := time.Parse(time.RFC3339, *req.Inicio)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid start date format",
+				"details": "Expected ISO 8601 format (e.g., 2024-01-15T10:00:00Z)",
+			})
+			return
+		}
+		upd.Inicio = &inicio
+	}
+
+	if req.Fim != nil {
+		fim, err := time.Parse(time.RFC3339, *req.Fim)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid end date format",
+				"details": "Expected ISO 8601 format (e.g., 2024-01-15T12:00:00Z)",
+			})
+			return
+		}
+		upd.Fim = &fim
+	}
+
+	auction, err := s.msLeilao.UpdateAuction(c.Param("id"), upd)
+	if err != nil {
+		c.JSON(auctionErrorStatus(err), gin.H{"error": fmt.Sprintf("error updating auction: %s", err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, auction)
+}
+
+func (s *Server) CancelAuction(c *gin.Context) {
+	if err := s.msLeilao.CancelAuction(c.Param("id")); err != nil {
+		c.JSON(auctionErrorStatus(err), gin.H{"error": fmt.Sprintf("error cancelling auction: %s", err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func auctionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, msleilao.ErrAuctionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, msleilao.ErrAuctionClosed):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func (s *Server) FastForward(c *gin.Context) {
+	var req struct {
+		To string `json:"to"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad fast-forward format"})
+		return
+	}
+
+	var to msleilao.EventKind
+	switch req.To {
+	case "start":
+		to = msleilao.EventStart
+	case "end":
+		to = msleilao.EventEnd
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": `"to" must be "start" or "end"`})
+		return
+	}
+
+	if err := s.msLeilao.FastForward(c.Param("id"), to); err != nil {
+		c.JSON(auctionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
@@ -2,7 +2,10 @@ package server
 
 import (
 	"auction-system/internal/msleilao"
+	"auction-system/pkg/clock"
+	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -12,14 +15,30 @@ import (
 
 type Server struct {
 	msLeilao *msleilao.MsLeilao
+	devAdmin bool
+	// internalToken libera as rotas internas; vazio, elas ficam fechadas
+	internalToken string
 }
 
-func NewServer(ch *amqp.Channel) *http.Server {
-	msLeilao := msleilao.NewMsLeilao(ch)
+func NewServer(ch *amqp.Channel) (*http.Server, error) {
+	dataFile := os.Getenv("MSLEILAO_DATA_FILE")
+	if dataFile == "" {
+		dataFile = "data/msleilao/auctions.json"
+	}
+
+	repo, err := msleilao.NewFileAuctionRepository(dataFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open auction repository: %w", err)
+	}
+
+	msLeilao := msleilao.NewMsLeilao(ch, repo, clock.New())
 	msLeilao.Start()
 
 	NewServer := &Server{
 		msLeilao: msLeilao,
+		devAdmin: os.Getenv("MSLEILAO_DEV_ADMIN") == "true",
+		// o mslance lê a mesma variável para chamar as rotas internas
+		internalToken: os.Getenv("MSLEILAO_INTERNAL_TOKEN"),
 	}
 
 	server := &http.Server{
@@ -30,7 +49,7 @@ func NewServer(ch *amqp.Channel) *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	return server
+	return server, nil
 }
 
 func (s *Server) registerRoutes() http.Handler {
@@ -45,6 +64,18 @@ func (s *Server) registerRoutes() http.Handler {
 
 	r.GET("/consult-auctions", s.ConsultAuctions)
 	r.POST("/create-auction", s.CreateAuction)
+	r.PATCH("/auctions/:id", s.UpdateAuction)
+	r.DELETE("/auctions/:id", s.CancelAuction)
+
+	// rotas internas, consumidas só pelo mslance. Expõem a reserva, então
+	// exigem o token de serviço
+	internal := r.Group("/internal", s.requireInternalToken)
+	internal.GET("/open-auctions", s.OpenAuctions)
+
+	// rotas de QA, nunca habilitar em produção
+	if s.devAdmin {
+		r.POST("/admin/auctions/:id/fast-forward", s.FastForward)
+	}
 
 	return r
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"auction-system/internal/mspagamento"
+	"auction-system/pkg/clock"
 	"auction-system/pkg/rabbitmq"
 	"fmt"
 	"net/http"
@@ -29,8 +30,18 @@ func main() {
 		httpAddr = ":8084"
 	}
 
+	purchasesFile := os.Getenv("MSPAGAMENTO_PURCHASES_FILE")
+	if purchasesFile == "" {
+		purchasesFile = "data/mspagamento/purchases.jsonl"
+	}
+	compras, err := mspagamento.NewFilePurchaseRepository(purchasesFile)
+	if err != nil {
+		panic(fmt.Sprintf("failed to open credit purchases: %s", err))
+	}
+	defer compras.Close()
+
 	// Create MS Pagamento instance
-	ms := mspagamento.NewMsPagamento(ch, externalPayURL, publicURL, "ms_pagamentos", httpAddr)
+	ms := mspagamento.NewMsPagamento(ch, clock.New(), compras, externalPayURL, publicURL, "ms_pagamentos", httpAddr)
 
 	// Start background listeners
 	go ms.Start()
@@ -43,7 +54,5 @@ func main() {
 	<-forever
 
 	fmt.Println("\n[MS PAGAMENTO] Shutting down gracefully...")
-	if err := http.DefaultClient.CloseIdleConnections; err != nil {
-		fmt.Println("error closing HTTP connections:", err)
-	}
-}
\ No newline at end of file
+	http.DefaultClient.CloseIdleConnections()
+}
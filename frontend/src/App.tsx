@@ -2,12 +2,12 @@ import { useEffect, useState } from "react";
 import "./App.css";
 import AuctionView from "./AuctionView";
 import type { Auction } from "./lib/types";
+import { formatMoney } from "./lib/types";
 import { api } from "./lib/api";
 import bellIcon from "./assets/bell.svg";
 import selectedBellIcon from "./assets/bell-selected.svg";
 import { useSSE } from "./hooks/useSSE";
 import toast, { Toaster } from "react-hot-toast";
-import { useUser } from "./hooks/useUser";
 
 const REFRESH_AUCTIONS_TIME = 5 * 1000; // 5 seconds
 
@@ -24,16 +24,15 @@ function App() {
     start: "",
     end: "",
   });
-  const { userId } = useUser();
 
   const handleNotification = (notification: any) => {
-    const { type, data, leilao_id } = notification;
+    const { type, data, leilao_id, you } = notification;
     const auction = auctions.find((a: Auction) => a.id === String(leilao_id));
 
     switch (type) {
       case "lance_validado":
         toast.success(
-          `Novo lance de R$ ${data.valor} no leilão ${auction?.description}!`,
+          `Novo lance de ${formatMoney(data.valor)} no leilão ${auction?.description}!`,
           {
             duration: 4000,
             icon: "🔨",
@@ -52,14 +51,24 @@ function App() {
         });
         break;
 
+      case "lance_superado":
+        toast.error(
+          `Seu lance no leilão ${auction?.description ?? leilao_id} foi superado: ${formatMoney(data.valor)}`,
+          {
+            duration: 6000,
+            icon: "⚠️",
+          }
+        );
+        break;
+
       case "leilao_vencedor":
-        if (data.vencedor_id === userId) {
+        if (you) {
           toast.success("🎉 Você venceu o leilão!", {
             duration: 6000,
           });
         } else {
           toast(
-            `Leilão ${leilao_id} encerrado por R$${data.valor_final}. ID do Vencedor: ${data.vencedor_id}`,
+            `Leilão ${leilao_id} encerrado por ${formatMoney(data.valor_final)}. Vencedor: ${data.user_id ?? data.vencedor}`,
             {
               duration: 5000,
               icon: "ℹ️",
@@ -68,6 +77,95 @@ function App() {
         }
         break;
 
+      case "leilao_prorrogado": {
+        const end = new Date(data.data_fim);
+        setAuctions((prev) =>
+          prev.map((a) => (a.id === leilao_id ? { ...a, end } : a))
+        );
+        if (auctionDetails?.id === leilao_id) {
+          setAuctionDetails({ ...auctionDetails, end });
+        }
+        toast(`Leilão ${auction?.description} prorrogado até ${end.toLocaleTimeString()}`, {
+          duration: 4000,
+          icon: "⏱️",
+        });
+        break;
+      }
+
+      case "leilao_atualizado": {
+        const changes = {
+          description: data.descricao,
+          start: new Date(data.data_inicio),
+          end: new Date(data.data_fim),
+        };
+        setAuctions((prev) =>
+          prev.map((a) => (a.id === leilao_id ? { ...a, ...changes } : a))
+        );
+        if (auctionDetails?.id === leilao_id) {
+          setAuctionDetails({ ...auctionDetails, ...changes });
+        }
+        toast(`Leilão ${data.descricao} atualizado: termina em ${changes.end.toLocaleString()}`, {
+          duration: 4000,
+          icon: "✏️",
+        });
+        break;
+      }
+
+      case "leilao_cancelado": {
+        const changes = { active: false, state: "cancelled" as const };
+        setAuctions((prev) =>
+          prev.map((a) => (a.id === leilao_id ? { ...a, ...changes } : a))
+        );
+        if (auctionDetails?.id === leilao_id) {
+          setAuctionDetails({ ...auctionDetails, ...changes });
+        }
+        toast.error(`Leilão ${data.descricao ?? leilao_id} cancelado`, {
+          duration: 6000,
+          icon: "🚫",
+        });
+        break;
+      }
+
+      case "leilao_preco_atualizado": {
+        const price = data.preco;
+        setAuctions((prev) =>
+          prev.map((a) => (a.id === leilao_id ? { ...a, price } : a))
+        );
+        if (auctionDetails?.id === leilao_id) {
+          setAuctionDetails({ ...auctionDetails, price });
+        }
+        toast(`Leilão ${auction?.description ?? leilao_id} agora custa ${formatMoney(price)}`, {
+          duration: 3000,
+          icon: "📉",
+        });
+        break;
+      }
+
+      case "leilao_reserva_nao_atingida": {
+        const changes = { active: false, state: "unsold" as const };
+        setAuctions((prev) =>
+          prev.map((a) => (a.id === leilao_id ? { ...a, ...changes } : a))
+        );
+        if (auctionDetails?.id === leilao_id) {
+          setAuctionDetails({ ...auctionDetails, ...changes });
+        }
+        if (you) {
+          toast.error(
+            `Seu lance de ${formatMoney(data.maior_lance)} foi o maior, mas não atingiu a reserva do leilão ${auction?.description ?? leilao_id}`,
+            { duration: 6000 }
+          );
+        } else {
+          toast(
+            `Leilão ${auction?.description ?? leilao_id} encerrado sem atingir a reserva (maior lance: ${formatMoney(data.maior_lance)})`,
+            {
+              duration: 5000,
+              icon: "ℹ️",
+            }
+          );
+        }
+        break;
+      }
+
       case "link_pagamento":
         toast(
           (t) => (
@@ -129,7 +227,13 @@ function App() {
         active: a.active,
       }));
 
-      setAuctions(auctionsTyped);
+      // o preço holandês só chega pelo SSE; não some a cada atualização da lista
+      setAuctions((prev) =>
+        auctionsTyped.map((a) => ({
+          ...a,
+          price: prev.find((p) => p.id === a.id)?.price,
+        }))
+      );
     } catch (error) {
       console.error("error fetching auctions:", error);
     }
@@ -1,7 +1,8 @@
-import { useEffect, useState } from "react";
+import { useEffect, useRef, useState } from "react";
 import "./AuctionView.css";
-import type { Auction } from "./lib/types";
-import { api } from "./lib/api";
+import type { Auction, BidRecord } from "./lib/types";
+import { formatMoney } from "./lib/types";
+import { api, ApiError } from "./lib/api";
 import { useUser } from "./hooks/useUser";
 
 interface Props {
@@ -14,36 +15,60 @@ function AuctionView({ auction, onClose }: Props) {
 
   const [bidValue, setBidValue] = useState<string>("");
   const [highestBid, setHighestBid] = useState<string>("");
+  const [bids, setBids] = useState<BidRecord[]>([]);
   const { userId } = useUser();
+  // bidKey identifica o lance que o usuário quer dar: todas as tentativas de
+  // enviá-lo usam a mesma chave, que só é trocada depois de uma resposta
+  // definitiva ou quando o lance muda
+  const bidKey = useRef<string | null>(null);
 
   useEffect(() => {
     const getHighestBid = async () => {
       try {
         const data: any = await api(`/highest-bid?auctionId=${auction.id}`);
-        if (data.highest_bid && data.highest_bid !== "") {
-          setHighestBid(data.highest_bid);
+        if (data.highest_bid?.amount) {
+          setHighestBid(formatMoney(data.highest_bid));
         }
       } catch (error) {
         console.error("error fetching highest bid:", error);
       }
     };
 
+    const getBids = async () => {
+      try {
+        const data: any = await api(`/auctions/${auction.id}/bids?page_size=10`);
+        setBids(data.bids ?? []);
+      } catch (error) {
+        console.error("error fetching bid history:", error);
+      }
+    };
+
     getHighestBid();
+    getBids();
+    bidKey.current = null;
   }, [auction]);
 
   const submitBid = async (e: React.FormEvent) => {
     e.preventDefault();
 
+    bidKey.current ??= crypto.randomUUID();
     try {
-      await api("/make-bid", {
+      await api("/bids", {
         method: "POST",
+        headers: { "Idempotency-Key": bidKey.current },
         body: JSON.stringify({
           valor: bidValue,
           leilao_id: auction.id,
           user_id: userId,
         }),
       });
+      bidKey.current = null;
     } catch (error) {
+      // sem resposta ou com erro do servidor o lance pode ter sido registrado;
+      // a próxima tentativa reaproveita a chave para não duplicá-lo
+      if (error instanceof ApiError && error.status < 500) {
+        bidKey.current = null;
+      }
       console.error("error sending bid:", error);
     }
   };
@@ -62,13 +87,17 @@ function AuctionView({ auction, onClose }: Props) {
 
         {auction.active && (
           <>
+            {auction.price && <h3>Preço atual: {formatMoney(auction.price)}</h3>}
             <h3>Maior lance: {highestBid}</h3>
             <form className="form-bid" onSubmit={submitBid}>
               <h3>Make a bid:</h3>
               <input
                 type="number"
                 value={bidValue}
-                onChange={(e) => setBidValue(e.target.value)}
+                onChange={(e) => {
+                  setBidValue(e.target.value);
+                  bidKey.current = null;
+                }}
                 placeholder="Enter bid amount"
                 required
               />
@@ -76,6 +105,20 @@ function AuctionView({ auction, onClose }: Props) {
             </form>
           </>
         )}
+
+        {bids.length > 0 && (
+          <>
+            <h3>Histórico de lances</h3>
+            <ul className="bid-history">
+              {bids.map((bid) => (
+                <li key={bid.seq}>
+                  #{bid.seq} {bid.user_id ?? bid.pseudonimo}: {formatMoney(bid.valor)}{" "}
+                  {bid.status === "rejected" ? `(recusado: ${bid.motivo})` : ""}
+                </li>
+              ))}
+            </ul>
+          </>
+        )}
       </div>
     </div>
   );
@@ -15,7 +15,9 @@ export function useSSE(
         registeredAuctionsID.forEach((auctionId) => {
         if (!eventSourcesRef.current.has(auctionId)) {
             const eventSource = new EventSource(
-            `${BASE_URL}/register-interest/${auctionId}/stream?clienteID=${userId}`
+            `${BASE_URL}/register-interest/${auctionId}/stream?clienteID=${userId}`,
+            // leva o cookie admin_token, que o gateway usa para os admins
+            { withCredentials: true }
             );
 
             eventSource.addEventListener('lance_validado', (e) => {
@@ -43,6 +45,36 @@ export function useSSE(
                 onNotification({ ...data, auctionId });
             });
 
+            eventSource.addEventListener('leilao_atualizado', (e) => {
+                const data = JSON.parse(e.data);
+                onNotification({ ...data, auctionId });
+            });
+
+            eventSource.addEventListener('leilao_cancelado', (e) => {
+                const data = JSON.parse(e.data);
+                onNotification({ ...data, auctionId });
+            });
+
+            eventSource.addEventListener('leilao_reserva_nao_atingida', (e) => {
+                const data = JSON.parse(e.data);
+                onNotification({ ...data, auctionId });
+            });
+
+            eventSource.addEventListener('leilao_prorrogado', (e) => {
+                const data = JSON.parse(e.data);
+                onNotification({ ...data, auctionId });
+            });
+
+            eventSource.addEventListener('leilao_preco_atualizado', (e) => {
+                const data = JSON.parse(e.data);
+                onNotification({ ...data, auctionId });
+            });
+
+            eventSource.addEventListener('lance_superado', (e) => {
+                const data = JSON.parse(e.data);
+                onNotification({ ...data, auctionId });
+            });
+
             eventSource.onerror = (error) => {
                 console.error(`SSE error for auction ${auctionId}:`, error);
                 eventSource.close();
@@ -1,5 +1,15 @@
 export const BASE_URL = "http://localhost:8080";
 
+// ApiError é a resposta de erro do gateway; quem chama pode olhar o status
+export class ApiError extends Error {
+  status: number;
+
+  constructor(status: number, message: string) {
+    super(message);
+    this.status = status;
+  }
+}
+
 export async function api(
   endpoint: string,
   options?: RequestInit
@@ -18,12 +28,12 @@ export async function api(
   const text = await response.text();
 
   if (!response.ok) {
+    let message = `HTTP ${response.status}: ${text}`;
     try {
       const error = JSON.parse(text);
-      throw new Error(error.error || error.message || `HTTP ${response.status}`);
-    } catch {
-      throw new Error(`HTTP ${response.status}: ${text}`);
-    }
+      message = error.error || error.message || `HTTP ${response.status}`;
+    } catch {}
+    throw new ApiError(response.status, message);
   }
 
   return text ? JSON.parse(text) : {};
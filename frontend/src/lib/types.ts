@@ -1,18 +1,55 @@
 
 
+export type Money = {
+    amount: number; // centavos
+    currency: string;
+}
+
+export function formatMoney(m: Money | null | undefined): string {
+    if (!m) return "";
+    return `${m.currency} ${(m.amount / 100).toFixed(2)}`;
+}
+
+export type AuctionState =
+    | 'scheduled'
+    | 'active'
+    | 'closed'
+    | 'awaiting_payment'
+    | 'settled'
+    | 'cancelled'
+    | 'unsold';
+
 export type Auction = {
     id: string;
     description: string;
     start: Date;
     end: Date;
     active: boolean;
+    state?: AuctionState;
+    // price é o preço atual de um leilão holandês, atualizado pelo SSE
+    price?: Money;
+}
+
+export type BidRecord = {
+    seq: number;
+    leilao_id: string;
+    user_id?: string;
+    pseudonimo?: string;
+    valor: Money;
+    quantidade?: number;
+    kind: 'bid' | 'proxy' | 'buy_now';
+    status: 'accepted' | 'rejected';
+    motivo?: string;
+    codigo?: string;
+    timestamp: string;
 }
 
 export interface Notification {
-  type: 'lance_validado' | 'lance_invalidado' | 'leilao_vencedor' | 'link_pagamento' | 'status_pagamento';
-  leilao_id: number;
+  type: 'lance_validado' | 'lance_invalidado' | 'leilao_vencedor' | 'link_pagamento' | 'status_pagamento' | 'leilao_atualizado' | 'leilao_cancelado' | 'leilao_reserva_nao_atingida' | 'leilao_prorrogado' | 'leilao_preco_atualizado' | 'lance_superado';
+  leilao_id: string;
   cliente_id?: number;
   data: any;
+  you?: boolean;
   timestamp: string;
   auctionId: string;
 }
\ No newline at end of file
@@ -0,0 +1,124 @@
+package rabbitmq
+
+import (
+	"auction-system/pkg/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// consumeReplies cria a fila exclusiva desta instância do gateway para as
+// respostas do mslance e entrega cada uma a quem publicou o lance
+func (r *RabbitMQConsumer) consumeReplies() error {
+	q, err := r.channel.QueueDeclare(
+		"",
+		false,
+		true,
+		true,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	msgs, err := r.channel.Consume(
+		q.Name,
+		"",
+		true,
+		true,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	r.replyQueue = q.Name
+
+	go func() {
+		for msg := range msgs {
+			var resultado models.ResultadoLance
+			if err := json.Unmarshal(msg.Body, &resultado); err != nil {
+				log.Printf("Error parsing bid reply: %v", err)
+				continue
+			}
+
+			r.mu.Lock()
+			waiting, ok := r.pending[msg.CorrelationId]
+			delete(r.pending, msg.CorrelationId)
+			r.mu.Unlock()
+
+			// a resposta chegou depois que o cliente desistiu de esperar; o
+			// resultado já foi para a sala por lance.validado/lance.invalidado
+			if !ok {
+				continue
+			}
+			waiting <- resultado
+		}
+	}()
+
+	log.Printf("Started consuming bid replies: %s", q.Name)
+	return nil
+}
+
+// PublishBid publica o lance em lance.realizado e espera a resposta do mslance até ctx acabar. A mensagem é persistente:
+// se o mslance estiver fora do ar o lance fica na fila e a resposta volta com
+// status queued; o resultado chega depois pelos eventos do leilão
+//
+// A resposta é casada por um correlation id novo a cada publicação, não pelo
+// bid_id: o cliente pode reenviar o mesmo bid_id enquanto a primeira tentativa
+// ainda espera, e cada uma precisa receber a própria resposta
+func (r *RabbitMQConsumer) PublishBid(ctx context.Context, lance models.LanceRealizado) (models.ResultadoLance, error) {
+	body, err := json.Marshal(lance)
+	if err != nil {
+		return models.ResultadoLance{}, err
+	}
+
+	correlationID := uuid.NewString()
+	waiting := make(chan models.ResultadoLance, 1)
+	r.mu.Lock()
+	r.pending[correlationID] = waiting
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, correlationID)
+		r.mu.Unlock()
+	}()
+
+	err = r.channel.PublishWithContext(
+		ctx,
+		"leilao_events",
+		"lance.realizado",
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
+			CorrelationId: correlationID,
+			ReplyTo:       r.replyQueue,
+			Body:          body,
+		},
+	)
+	if err != nil {
+		return models.ResultadoLance{}, fmt.Errorf("failed to publish bid: %w", err)
+	}
+
+	select {
+	case resultado := <-waiting:
+		return resultado, nil
+	case <-ctx.Done():
+		return models.ResultadoLance{
+			BidID:    lance.BidID,
+			LeilaoID: lance.LeilaoID,
+			UserID:   lance.UserID,
+			Status:   models.LanceEnfileirado,
+		}, nil
+	}
+}
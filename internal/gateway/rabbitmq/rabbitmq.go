@@ -5,7 +5,7 @@ import (
 	"auction-system/pkg/models"
 	"encoding/json"
 	"log"
-	"strconv"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -15,6 +15,12 @@ type RabbitMQConsumer struct {
 	conn        *amqp.Connection
 	channel     *amqp.Channel
 	eventStream *sse.EventStream
+
+	// replyQueue recebe as respostas do mslance aos lances publicados em
+	// lance.realizado; pending liga cada correlation id a quem espera
+	replyQueue string
+	pending    map[string]chan models.ResultadoLance
+	mu         sync.Mutex
 }
 
 func NewRabbitMQConsumer(rabbitURL string, eventStream *sse.EventStream) (*RabbitMQConsumer, error) {
@@ -33,6 +39,7 @@ func NewRabbitMQConsumer(rabbitURL string, eventStream *sse.EventStream) (*Rabbi
 		conn:        conn,
 		channel:     ch,
 		eventStream: eventStream,
+		pending:     make(map[string]chan models.ResultadoLance),
 	}, nil
 }
 
@@ -60,11 +67,22 @@ func (r *RabbitMQConsumer) setupQueues() error {
 	}
 
 	queuesBindings := map[string]string{
-		"link_pagamento":   "link.pagamento",
-		"status_pagamento": "status.pagamento",
-		"lance_validado":   "lance.validado",
-		"lance_invalidado": "lance.invalidado",
-		"leilao_vencedor":  "leilao.vencedor",
+		"link_pagamento":            "link.pagamento",
+		"status_pagamento":          "status.pagamento",
+		"lance_validado":            "lance.validado",
+		"lance_invalidado":          "lance.invalidado",
+		"leilao_vencedor":           "leilao.vencedor",
+		"gateway_leilao_atualizado": "leilao.atualizado",
+		"gateway_leilao_cancelado":  "leilao.cancelado",
+
+		"gateway_leilao_reserva_nao_atingida": "leilao.reserva_nao_atingida",
+		"gateway_leilao_prorrogado":           "leilao.prorrogado",
+		"gateway_leilao_preco_atualizado":     "leilao.preco_atualizado",
+		"gateway_lance_superado":              "lance.superado",
+
+		// consumida pelo mslance; declarada aqui também para que os lances
+		// publicados com o mslance fora do ar fiquem retidos na fila
+		"lance_realizado": "lance.realizado",
 	}
 
 	for queueName, routingKey := range queuesBindings {
@@ -103,11 +121,18 @@ func (r *RabbitMQConsumer) ConsumeQueues() error {
 	}
 
 	queues := map[string]func(amqp.Delivery){
-		"lance_validado":   r.handleLanceValidado,
-		"leilao_vencedor":  r.handleLeilaoVencedor,
-		"lance_invalidado": r.handleLanceInvalidado,
-		"status_pagamento": r.handleStatusPagamento,
-		"link_pagamento":   r.handleLinkPagamento,
+		"lance_validado":            r.handleLanceValidado,
+		"leilao_vencedor":           r.handleLeilaoVencedor,
+		"lance_invalidado":          r.handleLanceInvalidado,
+		"status_pagamento":          r.handleStatusPagamento,
+		"link_pagamento":            r.handleLinkPagamento,
+		"gateway_leilao_atualizado": r.handleLeilaoAtualizado,
+		"gateway_leilao_cancelado":  r.handleLeilaoCancelado,
+
+		"gateway_leilao_reserva_nao_atingida": r.handleLeilaoReservaNaoAtingida,
+		"gateway_leilao_prorrogado":           r.handleLeilaoProrrogado,
+		"gateway_leilao_preco_atualizado":     r.handleLeilaoPrecoAtualizado,
+		"gateway_lance_superado":              r.handleLanceSuperado,
 	}
 
 	for queueName, handler := range queues {
@@ -116,7 +141,7 @@ func (r *RabbitMQConsumer) ConsumeQueues() error {
 		}
 	}
 
-	return nil
+	return r.consumeReplies()
 }
 
 func (r *RabbitMQConsumer) consumeQueue(queueName string, handler func(amqp.Delivery)) error {
@@ -158,11 +183,15 @@ func (r *RabbitMQConsumer) handleStatusPagamento(msg amqp.Delivery) {
 
 	log.Printf("Status pagamento: user=%s, leilao=%s, status=%s", statusPagamento.WinnerID, statusPagamento.AuctionID, statusPagamento.Status)
 
-	leilaoID, _ := strconv.Atoi(statusPagamento.AuctionID)
+	if err := models.ValidateAuctionID(statusPagamento.AuctionID); err != nil {
+		log.Printf("Error parsing status_pagamento: %v", err)
+		msg.Nack(false, false)
+		return
+	}
 
 	notification := sse.Notification{
 		Type:      sse.StatusPagamento,
-		LeilaoID:  leilaoID,
+		LeilaoID:  statusPagamento.AuctionID,
 		ClienteID: statusPagamento.WinnerID,
 		Data: map[string]interface{}{
 			"transaction_id": statusPagamento.TransactionID,
@@ -187,11 +216,15 @@ func (r *RabbitMQConsumer) handleLinkPagamento(msg amqp.Delivery) {
 
 	log.Printf("Status pagamento: user=%s, link=%s, auctionId=%s", linkPagamento.UserID, linkPagamento.PaymentLink, linkPagamento.AuctionID)
 
-	leilaoID, _ := strconv.Atoi(linkPagamento.AuctionID)
+	if err := models.ValidateAuctionID(linkPagamento.AuctionID); err != nil {
+		log.Printf("Error parsing link_pagamento: %v", err)
+		msg.Nack(false, false)
+		return
+	}
 
 	notification := sse.Notification{
 		Type:      sse.LinkPagamento,
-		LeilaoID:  leilaoID,
+		LeilaoID:  linkPagamento.AuctionID,
 		ClienteID: linkPagamento.UserID,
 		Data: map[string]interface{}{
 			"payment_link":   linkPagamento.PaymentLink,
@@ -213,18 +246,25 @@ func (r *RabbitMQConsumer) handleLanceValidado(msg amqp.Delivery) {
 		return
 	}
 
-	log.Printf("Lance validado: user=%s, leilao=%s, valor=%.2f", lance.UserID, lance.LeilaoID, lance.Valor)
+	log.Printf("Lance validado: user=%s, leilao=%s, valor=%s", lance.UserID, lance.LeilaoID, lance.Valor)
 
-	leilaoID, _ := strconv.Atoi(lance.LeilaoID)
+	if err := models.ValidateAuctionID(lance.LeilaoID); err != nil {
+		log.Printf("Error parsing lance_validado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
 
+	// a sala só vê o pseudônimo; o EventStream marca o autor e mostra o ID aos admins
 	notification := sse.Notification{
 		Type:      sse.LanceValidado,
-		LeilaoID:  leilaoID,
+		LeilaoID:  lance.LeilaoID,
 		ClienteID: "",
+		AutorID:   lance.UserID,
 		Data: map[string]interface{}{
-			"user_id":   lance.UserID,
-			"valor":     lance.Valor,
-			"leilao_id": lance.LeilaoID,
+			"pseudonimo": lance.Pseudonimo,
+			"valor":      lance.Valor,
+			"quantidade": max(lance.Quantidade, 1),
+			"leilao_id":  lance.LeilaoID,
 		},
 		Timestamp: time.Now(),
 	}
@@ -241,19 +281,24 @@ func (r *RabbitMQConsumer) handleLanceInvalidado(msg amqp.Delivery) {
 		return
 	}
 
-	log.Printf("Lance invalidado: user=%s, leilao=%s, valor=%.2f", lance.UserID, lance.LeilaoID, lance.Valor)
+	log.Printf("Lance invalidado: user=%s, leilao=%s, valor=%s", lance.UserID, lance.LeilaoID, lance.Valor)
 
-	leilaoID, _ := strconv.Atoi(lance.LeilaoID)
+	if err := models.ValidateAuctionID(lance.LeilaoID); err != nil {
+		log.Printf("Error parsing lance_invalidado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
 
 	notification := sse.Notification{
 		Type:      sse.LanceInvalidado,
-		LeilaoID:  leilaoID,
+		LeilaoID:  lance.LeilaoID,
 		ClienteID: lance.UserID,
 		Data: map[string]interface{}{
 			"user_id":   lance.UserID,
 			"valor":     lance.Valor,
 			"leilao_id": lance.LeilaoID,
 			"motivo":    lance.Motivo,
+			"codigo":    lance.Codigo,
 		},
 		Timestamp: time.Now(),
 	}
@@ -262,6 +307,40 @@ func (r *RabbitMQConsumer) handleLanceInvalidado(msg amqp.Delivery) {
 	msg.Ack(false)
 }
 
+// handleLanceSuperado avisa só o participante que perdeu a liderança; se ele
+// não estiver conectado o aviso fica guardado no EventStream
+func (r *RabbitMQConsumer) handleLanceSuperado(msg amqp.Delivery) {
+	var superado models.LanceSuperado
+	if err := json.Unmarshal(msg.Body, &superado); err != nil {
+		log.Printf("Error parsing lance_superado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	log.Printf("Lance superado: user=%s, leilao=%s, valor=%s", superado.UserID, superado.LeilaoID, superado.Valor)
+
+	if err := models.ValidateAuctionID(superado.LeilaoID); err != nil {
+		log.Printf("Error parsing lance_superado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	notification := sse.Notification{
+		Type:      sse.LanceSuperado,
+		LeilaoID:  superado.LeilaoID,
+		ClienteID: superado.UserID,
+		Data: map[string]interface{}{
+			"user_id":   superado.UserID,
+			"valor":     superado.Valor,
+			"leilao_id": superado.LeilaoID,
+		},
+		Timestamp: superado.Timestamp,
+	}
+
+	r.eventStream.Message <- notification
+	msg.Ack(false)
+}
+
 func (r *RabbitMQConsumer) handleLeilaoVencedor(msg amqp.Delivery) {
 	var vencedor models.LeilaoVencedor
 	if err := json.Unmarshal(msg.Body, &vencedor); err != nil {
@@ -270,16 +349,23 @@ func (r *RabbitMQConsumer) handleLeilaoVencedor(msg amqp.Delivery) {
 		return
 	}
 
-	log.Printf("Vencedor: user=%s, leilao=%s, valor=%.2f", vencedor.UserID, vencedor.LeilaoID, vencedor.Valor)
+	log.Printf("Vencedor: user=%s, leilao=%s, valor=%s", vencedor.UserID, vencedor.LeilaoID, vencedor.Preco())
 
-	leilaoID, _ := strconv.Atoi(vencedor.LeilaoID)
+	if err := models.ValidateAuctionID(vencedor.LeilaoID); err != nil {
+		log.Printf("Error parsing leilao_vencedor: %v", err)
+		msg.Nack(false, false)
+		return
+	}
 
 	notification := sse.Notification{
 		Type:     sse.LeilaoVencedor,
-		LeilaoID: leilaoID,
+		LeilaoID: vencedor.LeilaoID,
+		AutorID:  vencedor.UserID,
 		Data: map[string]interface{}{
-			"vencedor_id": vencedor.UserID,
-			"valor_final": vencedor.Valor,
+			"vencedor":    vencedor.Pseudonimo,
+			"valor_final": vencedor.Preco(),
+			"quantidade":  max(vencedor.Quantidade, 1),
+			"direcao":     vencedor.Direcao,
 			"leilao_id":   vencedor.LeilaoID,
 		},
 		Timestamp: time.Now(),
@@ -288,3 +374,156 @@ func (r *RabbitMQConsumer) handleLeilaoVencedor(msg amqp.Delivery) {
 	r.eventStream.Message <- notification
 	msg.Ack(false)
 }
+
+func (r *RabbitMQConsumer) handleLeilaoAtualizado(msg amqp.Delivery) {
+	var leilao models.LeilaoAtualizado
+	if err := json.Unmarshal(msg.Body, &leilao); err != nil {
+		log.Printf("Error parsing leilao_atualizado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	if err := models.ValidateAuctionID(leilao.ID); err != nil {
+		log.Printf("Error parsing leilao_atualizado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	log.Printf("Leilão atualizado: leilao=%s", leilao.ID)
+
+	notification := sse.Notification{
+		Type:     sse.LeilaoAtualizado,
+		LeilaoID: leilao.ID,
+		Data: map[string]interface{}{
+			"leilao_id":   leilao.ID,
+			"descricao":   leilao.Descricao,
+			"data_inicio": leilao.DataInicio,
+			"data_fim":    leilao.DataFim,
+		},
+		Timestamp: time.Now(),
+	}
+
+	r.eventStream.Message <- notification
+	msg.Ack(false)
+}
+
+func (r *RabbitMQConsumer) handleLeilaoCancelado(msg amqp.Delivery) {
+	var leilao models.LeilaoCancelado
+	if err := json.Unmarshal(msg.Body, &leilao); err != nil {
+		log.Printf("Error parsing leilao_cancelado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	if err := models.ValidateAuctionID(leilao.ID); err != nil {
+		log.Printf("Error parsing leilao_cancelado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	log.Printf("Leilão cancelado: leilao=%s", leilao.ID)
+
+	notification := sse.Notification{
+		Type:     sse.LeilaoCancelado,
+		LeilaoID: leilao.ID,
+		Data: map[string]interface{}{
+			"leilao_id": leilao.ID,
+			"descricao": leilao.Descricao,
+		},
+		Timestamp: time.Now(),
+	}
+
+	r.eventStream.Message <- notification
+	msg.Ack(false)
+}
+
+func (r *RabbitMQConsumer) handleLeilaoReservaNaoAtingida(msg amqp.Delivery) {
+	var reserva models.LeilaoReservaNaoAtingida
+	if err := json.Unmarshal(msg.Body, &reserva); err != nil {
+		log.Printf("Error parsing leilao_reserva_nao_atingida: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	if err := models.ValidateAuctionID(reserva.LeilaoID); err != nil {
+		log.Printf("Error parsing leilao_reserva_nao_atingida: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	log.Printf("Reserva não atingida: leilao=%s, maior_lance=%s", reserva.LeilaoID, reserva.MaiorLance)
+
+	notification := sse.Notification{
+		Type:     sse.LeilaoReservaNaoAtingida,
+		LeilaoID: reserva.LeilaoID,
+		AutorID:  reserva.UserID,
+		Data: map[string]interface{}{
+			"leilao_id":   reserva.LeilaoID,
+			"maior_lance": reserva.MaiorLance,
+		},
+		Timestamp: time.Now(),
+	}
+
+	r.eventStream.Message <- notification
+	msg.Ack(false)
+}
+
+func (r *RabbitMQConsumer) handleLeilaoProrrogado(msg amqp.Delivery) {
+	var prorrogado models.LeilaoProrrogado
+	if err := json.Unmarshal(msg.Body, &prorrogado); err != nil {
+		log.Printf("Error parsing leilao_prorrogado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	if err := models.ValidateAuctionID(prorrogado.ID); err != nil {
+		log.Printf("Error parsing leilao_prorrogado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	log.Printf("Leilão prorrogado: leilao=%s, fim=%s", prorrogado.ID, prorrogado.DataFim.Format(time.RFC3339))
+
+	notification := sse.Notification{
+		Type:     sse.LeilaoProrrogado,
+		LeilaoID: prorrogado.ID,
+		Data: map[string]interface{}{
+			"leilao_id": prorrogado.ID,
+			"data_fim":  prorrogado.DataFim,
+		},
+		Timestamp: time.Now(),
+	}
+
+	r.eventStream.Message <- notification
+	msg.Ack(false)
+}
+
+func (r *RabbitMQConsumer) handleLeilaoPrecoAtualizado(msg amqp.Delivery) {
+	var preco models.LeilaoPrecoAtualizado
+	if err := json.Unmarshal(msg.Body, &preco); err != nil {
+		log.Printf("Error parsing leilao_preco_atualizado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	if err := models.ValidateAuctionID(preco.ID); err != nil {
+		log.Printf("Error parsing leilao_preco_atualizado: %v", err)
+		msg.Nack(false, false)
+		return
+	}
+
+	log.Printf("Preço atualizado: leilao=%s, preco=%s", preco.ID, preco.Preco)
+
+	notification := sse.Notification{
+		Type:     sse.LeilaoPrecoAtualizado,
+		LeilaoID: preco.ID,
+		Data: map[string]interface{}{
+			"leilao_id": preco.ID,
+			"preco":     preco.Preco,
+		},
+		Timestamp: time.Now(),
+	}
+
+	r.eventStream.Message <- notification
+	msg.Ack(false)
+}
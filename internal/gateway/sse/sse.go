@@ -1,8 +1,9 @@
 package sse
 
 import (
+	"auction-system/pkg/models"
+	"crypto/subtle"
 	"log"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,25 +12,49 @@ import (
 type EventType string
 
 const (
-	LanceValidado   EventType = "lance_validado"
-	LanceInvalidado EventType = "lance_invalidado"
-	LeilaoVencedor  EventType = "leilao_vencedor"
-	LinkPagamento   EventType = "link_pagamento"
-	StatusPagamento EventType = "status_pagamento"
+	LanceValidado    EventType = "lance_validado"
+	LanceInvalidado  EventType = "lance_invalidado"
+	LeilaoVencedor   EventType = "leilao_vencedor"
+	LinkPagamento    EventType = "link_pagamento"
+	StatusPagamento  EventType = "status_pagamento"
+	LeilaoAtualizado EventType = "leilao_atualizado"
+	LeilaoCancelado  EventType = "leilao_cancelado"
+
+	LeilaoReservaNaoAtingida EventType = "leilao_reserva_nao_atingida"
+	LeilaoProrrogado         EventType = "leilao_prorrogado"
+	LeilaoPrecoAtualizado    EventType = "leilao_preco_atualizado"
+	LanceSuperado            EventType = "lance_superado"
+)
+
+// Os avisos guardados para usuários desconectados ficam só em memória e se
+// perdem num restart do gateway: a entrega é de melhor esforço. Para não
+// crescerem sem limite, cada usuário guarda até maxPendentes avisos (os mais
+// antigos saem primeiro), no máximo maxUsuariosPendentes usuários têm avisos
+// guardados e um aviso com mais de pendenteTTL é descartado
+const (
+	maxPendentes         = 50
+	maxUsuariosPendentes = 10000
+	pendenteTTL          = 24 * time.Hour
 )
 
 type Notification struct {
 	Type      EventType   `json:"type"`
-	LeilaoID  int         `json:"leilao_id"`
+	LeilaoID  string      `json:"leilao_id"`
 	ClienteID string      `json:"cliente_id,omitempty"`
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
+	// AutorID é o participante por trás de um evento público. Não sai para a
+	// sala: serve para marcar Voce e para mostrar o ID real aos admins
+	AutorID string `json:"-"`
+	Voce    bool   `json:"you,omitempty"`
 }
 
 type Client struct {
 	ID       string
-	LeilaoID int
+	LeilaoID string
 	Channel  chan Notification
+	// Admin recebe os eventos públicos com o ID real do participante
+	Admin bool
 }
 
 type EventStream struct {
@@ -37,8 +62,15 @@ type EventStream struct {
 	NewClients    chan Client
 	ClosedClients chan Client
 
-	ClientsByLeilao map[int]map[string]chan Notification
+	ClientsByLeilao map[string]map[string]chan Notification
 	ClientsByID     map[string]chan Notification
+	Admins          map[string]bool
+	// Pendentes guarda, por usuário, os avisos privados que chegaram enquanto
+	// ele estava desconectado. São entregues quando ele abre um stream, dentro
+	// dos limites descritos em maxPendentes
+	Pendentes map[string][]Notification
+
+	adminToken string
 }
 
 func (s *EventStream) listen() {
@@ -46,16 +78,26 @@ func (s *EventStream) listen() {
 		select {
 		case client := <-s.NewClients:
 			s.ClientsByID[client.ID] = client.Channel
+			s.Admins[client.ID] = client.Admin
 
 			if s.ClientsByLeilao[client.LeilaoID] == nil {
 				s.ClientsByLeilao[client.LeilaoID] = make(map[string]chan Notification)
 			}
 			s.ClientsByLeilao[client.LeilaoID][client.ID] = client.Channel
 
-			log.Printf("Cliente %s registrado no leilão %d", client.ID, client.LeilaoID)
+			log.Printf("Cliente %s registrado no leilão %s", client.ID, client.LeilaoID)
+
+			// o canal do cliente comporta maxPendentes, então a entrega não trava
+			for _, notif := range s.Pendentes[client.ID] {
+				if time.Since(notif.Timestamp) < pendenteTTL {
+					client.Channel <- notif
+				}
+			}
+			delete(s.Pendentes, client.ID)
 
 		case client := <-s.ClosedClients:
 			delete(s.ClientsByID, client.ID)
+			delete(s.Admins, client.ID)
 			if s.ClientsByLeilao[client.LeilaoID] != nil {
 				delete(s.ClientsByLeilao[client.LeilaoID], client.ID)
 			}
@@ -70,11 +112,11 @@ func (s *EventStream) listen() {
 
 func (s *EventStream) broadcastNotification(notif Notification) {
 	switch notif.Type {
-	case LanceValidado, LeilaoVencedor:
+	case LanceValidado, LeilaoVencedor, LeilaoAtualizado, LeilaoCancelado, LeilaoReservaNaoAtingida, LeilaoProrrogado, LeilaoPrecoAtualizado:
 		if clients, ok := s.ClientsByLeilao[notif.LeilaoID]; ok {
-			for _, ch := range clients {
-				log.Printf("mandando msg leilao vencedor %d", notif.LeilaoID)
-				ch <- notif
+			for id, ch := range clients {
+				log.Printf("mandando msg leilao vencedor %s", notif.LeilaoID)
+				ch <- s.paraCliente(notif, id)
 			}
 		}
 
@@ -82,13 +124,73 @@ func (s *EventStream) broadcastNotification(notif Notification) {
 		if ch, ok := s.ClientsByID[notif.ClienteID]; ok {
 			ch <- notif
 		}
+
+	case LanceSuperado:
+		if ch, ok := s.ClientsByID[notif.ClienteID]; ok {
+			ch <- notif
+			return
+		}
+		s.guardarPendente(notif)
+	}
+}
+
+// paraCliente ajusta um evento público para quem vai recebê-lo: o próprio
+// autor o recebe marcado com Voce e os admins recebem também o user_id real
+func (s *EventStream) paraCliente(notif Notification, clienteID string) Notification {
+	if notif.AutorID == "" {
+		return notif
+	}
+	notif.Voce = clienteID == notif.AutorID
+
+	if data, ok := notif.Data.(map[string]interface{}); ok && s.Admins[clienteID] {
+		comID := make(map[string]interface{}, len(data)+1)
+		for k, v := range data {
+			comID[k] = v
+		}
+		comID["user_id"] = notif.AutorID
+		notif.Data = comID
+	}
+	return notif
+}
+
+func (s *EventStream) guardarPendente(notif Notification) {
+	if _, ok := s.Pendentes[notif.ClienteID]; !ok && len(s.Pendentes) >= maxUsuariosPendentes {
+		s.descartarPendentes()
+	}
+
+	pendentes := append(s.Pendentes[notif.ClienteID], notif)
+	if len(pendentes) > maxPendentes {
+		pendentes = pendentes[len(pendentes)-maxPendentes:]
+	}
+	s.Pendentes[notif.ClienteID] = pendentes
+	log.Printf("Cliente %s desconectado, aviso %s guardado", notif.ClienteID, notif.Type)
+}
+
+// descartarPendentes abre espaço para um usuário novo: tira os avisos vencidos
+// e, se nenhum venceu, os do usuário cujo último aviso é o mais antigo
+func (s *EventStream) descartarPendentes() {
+	var maisAntigo string
+	var ultimo time.Time
+	for clienteID, pendentes := range s.Pendentes {
+		recente := pendentes[len(pendentes)-1].Timestamp
+		if time.Since(recente) >= pendenteTTL {
+			delete(s.Pendentes, clienteID)
+			continue
+		}
+		if maisAntigo == "" || recente.Before(ultimo) {
+			maisAntigo, ultimo = clienteID, recente
+		}
+	}
+	if len(s.Pendentes) >= maxUsuariosPendentes {
+		delete(s.Pendentes, maisAntigo)
+		log.Printf("Avisos guardados para %s descartados para abrir espaço", maisAntigo)
 	}
 }
 
 func (stream *EventStream) SSEConnMiddleware() gin.HandlerFunc {
 	return func(gctx *gin.Context) {
-		leilaoID, err := strconv.Atoi(gctx.Param("auctionID"))
-		if err != nil {
+		leilaoID := gctx.Param("auctionID")
+		if err := models.ValidateAuctionID(leilaoID); err != nil {
 			gctx.JSON(400, gin.H{"error": "invalid auctionID"})
 			gctx.Abort()
 			return
@@ -104,12 +206,13 @@ func (stream *EventStream) SSEConnMiddleware() gin.HandlerFunc {
 		client := Client{
 			ID:       clienteID,
 			LeilaoID: leilaoID,
-			Channel:  make(chan Notification),
+			Channel:  make(chan Notification, maxPendentes),
+			Admin:    stream.isAdmin(adminToken(gctx)),
 		}
 
 		stream.NewClients <- client
 		defer func() {
-			log.Printf("Fechando conexão do cliente %s no leilão %d", client.ID, client.LeilaoID)
+			log.Printf("Fechando conexão do cliente %s no leilão %s", client.ID, client.LeilaoID)
 			stream.ClosedClients <- client
 		}()
 
@@ -118,13 +221,33 @@ func (stream *EventStream) SSEConnMiddleware() gin.HandlerFunc {
 	}
 }
 
-func NewEventStream() *EventStream {
+// adminToken lê o token de admin do header X-Admin-Token ou, para o
+// EventSource do navegador, que não envia headers, do cookie admin_token.
+// Nunca da query: a URL acaba nos logs de acesso
+func adminToken(gctx *gin.Context) string {
+	if token := gctx.GetHeader("X-Admin-Token"); token != "" {
+		return token
+	}
+	token, _ := gctx.Cookie("admin_token")
+	return token
+}
+
+func (stream *EventStream) isAdmin(token string) bool {
+	return stream.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(stream.adminToken)) == 1
+}
+
+// NewEventStream cria o stream. adminToken é o token que dá acesso aos IDs
+// reais dos participantes; vazio, ninguém os recebe
+func NewEventStream(adminToken string) *EventStream {
 	stream := &EventStream{
 		Message:         make(chan Notification),
 		NewClients:      make(chan Client),
 		ClosedClients:   make(chan Client),
-		ClientsByLeilao: make(map[int]map[string]chan Notification),
+		ClientsByLeilao: make(map[string]map[string]chan Notification),
 		ClientsByID:     make(map[string]chan Notification),
+		Admins:          make(map[string]bool),
+		Pendentes:       make(map[string][]Notification),
+		adminToken:      adminToken,
 	}
 
 	go stream.listen()
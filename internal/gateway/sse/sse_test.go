@@ -0,0 +1,131 @@
+package sse
+
+import (
+	"auction-system/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParaCliente(t *testing.T) {
+	s := &EventStream{Admins: map[string]bool{"admin": true}}
+	notif := Notification{
+		Type:     LanceValidado,
+		AutorID:  "u1",
+		Data:     map[string]interface{}{"pseudonimo": "Bidder 1"},
+		LeilaoID: "l1",
+	}
+
+	casos := map[string]struct {
+		voce   bool
+		userID interface{}
+	}{
+		"u1":    {voce: true},
+		"u2":    {},
+		"admin": {userID: "u1"},
+	}
+	for cliente, want := range casos {
+		got := s.paraCliente(notif, cliente)
+		data := got.Data.(map[string]interface{})
+		if got.Voce != want.voce || data["user_id"] != want.userID {
+			t.Errorf("%s: you = %v, user_id = %v, want %v and %v", cliente, got.Voce, data["user_id"], want.voce, want.userID)
+		}
+		if data["pseudonimo"] != "Bidder 1" {
+			t.Errorf("%s: pseudonimo = %v, want it kept", cliente, data["pseudonimo"])
+		}
+	}
+	if _, ok := notif.Data.(map[string]interface{})["user_id"]; ok {
+		t.Error("paraCliente changed the shared event data")
+	}
+
+	semAutor := Notification{Type: LeilaoCancelado, Data: map[string]interface{}{}}
+	if got := s.paraCliente(semAutor, "admin"); got.Voce || len(got.Data.(map[string]interface{})) != 0 {
+		t.Errorf("event without author = %+v, want it unchanged", got)
+	}
+}
+
+func TestSSEAdminToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stream := NewEventStream("segredo")
+
+	r := gin.New()
+	r.GET("/stream/:auctionID", stream.SSEConnMiddleware(), func(c *gin.Context) {
+		if c.MustGet("client").(Client).Admin {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.Status(http.StatusForbidden)
+	})
+
+	id := models.NewAuctionID()
+	casos := map[string]struct {
+		prepara func(*http.Request)
+		admin   bool
+	}{
+		"header": {func(r *http.Request) { r.Header.Set("X-Admin-Token", "segredo") }, true},
+		"cookie": {func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "admin_token", Value: "segredo"}) }, true},
+		"query":  {func(r *http.Request) { r.URL.RawQuery += "&admin_token=segredo" }, false},
+		"wrong":  {func(r *http.Request) { r.Header.Set("X-Admin-Token", "errado") }, false},
+	}
+	for nome, c := range casos {
+		req := httptest.NewRequest(http.MethodGet, "/stream/"+id+"?clienteID="+nome, nil)
+		c.prepara(req)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if admin := rec.Code == http.StatusOK; admin != c.admin {
+			t.Errorf("%s: admin = %v, want %v", nome, admin, c.admin)
+		}
+	}
+}
+
+func TestPendentesBounded(t *testing.T) {
+	s := &EventStream{Pendentes: make(map[string][]Notification)}
+	agora := time.Now()
+
+	for i := 0; i < maxPendentes+5; i++ {
+		s.guardarPendente(Notification{Type: LanceSuperado, ClienteID: "u0", Timestamp: agora.Add(time.Duration(i) * time.Millisecond)})
+	}
+	if n := len(s.Pendentes["u0"]); n != maxPendentes {
+		t.Fatalf("u0 kept %d notifications, want %d", n, maxPendentes)
+	}
+
+	for i := 1; i < maxUsuariosPendentes; i++ {
+		s.guardarPendente(Notification{Type: LanceSuperado, ClienteID: "u" + strconv.Itoa(i), Timestamp: agora.Add(time.Second)})
+	}
+	s.guardarPendente(Notification{Type: LanceSuperado, ClienteID: "novo", Timestamp: agora.Add(2 * time.Second)})
+	if n := len(s.Pendentes); n != maxUsuariosPendentes {
+		t.Fatalf("%d users with notifications, want %d", n, maxUsuariosPendentes)
+	}
+	if _, ok := s.Pendentes["u0"]; ok {
+		t.Error("the user with the oldest notification was kept")
+	}
+	if _, ok := s.Pendentes["novo"]; !ok {
+		t.Error("the new user's notification was dropped")
+	}
+}
+
+func TestPendentesExpire(t *testing.T) {
+	stream := NewEventStream("")
+	stream.Message <- Notification{Type: LanceSuperado, ClienteID: "u1", LeilaoID: "velho", Timestamp: time.Now().Add(-pendenteTTL)}
+	stream.Message <- Notification{Type: LanceSuperado, ClienteID: "u1", LeilaoID: "novo", Timestamp: time.Now()}
+
+	client := Client{ID: "u1", LeilaoID: "novo", Channel: make(chan Notification, maxPendentes)}
+	stream.NewClients <- client
+	select {
+	case notif := <-client.Channel:
+		if notif.LeilaoID != "novo" {
+			t.Fatalf("delivered %s first, want the expired notification dropped", notif.LeilaoID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending notification not delivered")
+	}
+	select {
+	case notif := <-client.Channel:
+		t.Fatalf("delivered %+v, want only the fresh notification", notif)
+	default:
+	}
+}
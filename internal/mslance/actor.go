@@ -0,0 +1,116 @@
+package mslance
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// leilaoActor é dono do estado de um leilão. Tudo que lê ou altera o
+// LeilaoStatus passa pela inbox e roda na goroutine do leilão, uma mensagem
+// por vez, então leilões diferentes nunca disputam o mesmo lock. A goroutine
+// só existe enquanto há mensagens na inbox: um leilão parado não ocupa nada
+//
+// Depois de cada mensagem a goroutine publica um snapshot imutável, lido sem
+// lock por GetHighestBid e BidHistory
+type leilaoActor struct {
+	status *LeilaoStatus
+	// persist grava o estado depois de cada mensagem, na goroutine do leilão
+	persist func(LeilaoStatus)
+
+	mu      sync.Mutex
+	inbox   []mensagem
+	rodando bool
+
+	snapshot atomic.Pointer[leilaoSnapshot]
+}
+
+type mensagem struct {
+	fn func(*LeilaoStatus)
+	// depois roda na goroutine do leilão, quando o estado alterado por fn já
+	// foi gravado e o snapshot publicado
+	depois func()
+	// feito é fechado depois que fn roda e o snapshot é publicado
+	feito chan struct{}
+}
+
+// leilaoSnapshot é o que pode ser lido de fora da goroutine do leilão
+type leilaoSnapshot struct {
+	highest HighestBid
+	ativo   bool
+	selado  bool
+}
+
+func newLeilaoActor(status *LeilaoStatus, persist func(LeilaoStatus)) *leilaoActor {
+	a := &leilaoActor{status: status, persist: persist}
+	a.publicarSnapshot()
+	return a
+}
+
+// send enfileira fn sem esperar. Mensagens de um mesmo remetente rodam na
+// ordem em que foram enviadas
+func (a *leilaoActor) send(fn func(*LeilaoStatus)) {
+	a.enqueue(mensagem{fn: fn})
+}
+
+// sendThen enfileira fn sem esperar, como send, e roda depois na goroutine do
+// leilão assim que o estado alterado por fn estiver gravado
+func (a *leilaoActor) sendThen(fn func(*LeilaoStatus), depois func()) {
+	a.enqueue(mensagem{fn: fn, depois: depois})
+}
+
+// call enfileira fn e espera ela terminar. Ao retornar o snapshot já reflete
+// o que fn fez
+func (a *leilaoActor) call(fn func(*LeilaoStatus)) {
+	feito := make(chan struct{})
+	a.enqueue(mensagem{fn: fn, feito: feito})
+	<-feito
+}
+
+func (a *leilaoActor) enqueue(msg mensagem) {
+	a.mu.Lock()
+	a.inbox = append(a.inbox, msg)
+	iniciar := !a.rodando
+	a.rodando = true
+	a.mu.Unlock()
+
+	if iniciar {
+		go a.run()
+	}
+}
+
+// run consome a inbox até esvaziá-la. O lock só protege a fila; o estado do
+// leilão é acessado sem lock porque só uma run existe por vez. Quem espera em
+// call só é liberado depois que o estado foi gravado
+func (a *leilaoActor) run() {
+	for {
+		a.mu.Lock()
+		if len(a.inbox) == 0 {
+			a.inbox = nil
+			a.rodando = false
+			a.mu.Unlock()
+			return
+		}
+		msg := a.inbox[0]
+		a.inbox[0] = mensagem{}
+		a.inbox = a.inbox[1:]
+		a.mu.Unlock()
+
+		msg.fn(a.status)
+		a.persist(*a.status)
+		a.publicarSnapshot()
+		if msg.depois != nil {
+			msg.depois()
+		}
+		if msg.feito != nil {
+			close(msg.feito)
+		}
+	}
+}
+
+func (a *leilaoActor) publicarSnapshot() {
+	a.snapshot.Store(&leilaoSnapshot{
+		highest: a.status.highestBid(),
+		ativo:   a.status.Ativo,
+		selado:  a.status.Tipo.Sealed(),
+	})
+}
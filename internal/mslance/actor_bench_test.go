@@ -0,0 +1,133 @@
+package mslance
+
+import (
+	"auction-system/pkg/clock"
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(string, []byte) error { return nil }
+
+type discardHistory struct{}
+
+func (discardHistory) Append(rec BidRecord) (BidRecord, error) { return rec, nil }
+
+func (discardHistory) List(string, int, int) ([]BidRecord, int, error) { return nil, 0, nil }
+
+type discardStore struct{}
+
+func (discardStore) SaveLeilao(LeilaoStatus) error { return nil }
+
+func (discardStore) SaveCreditos(string, int, string) error { return nil }
+
+func (discardStore) Load() (EstadoSalvo, error) { return EstadoSalvo{}, nil }
+
+func benchMSLance(b *testing.B, leiloes int) (*MSLance, []string) {
+	b.Helper()
+
+	// o log global serializa todas as goroutines e esconderia o ganho
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// os arquivos de verdade, com fsync: um lock compartilhado em qualquer um
+	// deles apareceria aqui como falta de ganho com mais leilões
+	dir := b.TempDir()
+	history, err := NewFileBidHistory(filepath.Join(dir, "bids.jsonl"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { history.Close() })
+	store, err := NewFileStateStore(filepath.Join(dir, "state.jsonl"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { store.Close() })
+
+	clk := clock.New()
+	m := newMSLance(discardPublisher{}, clk, history, store)
+
+	ids := make([]string, leiloes)
+	for i := range ids {
+		ids[i] = models.NewAuctionID()
+		status := m.newLeilaoStatus(models.LeilaoIniciado{
+			ID:         ids[i],
+			Descricao:  fmt.Sprintf("leilão %d", i),
+			DataInicio: clk.Now(),
+			DataFim:    clk.Now().Add(time.Hour),
+			Increments: models.IncrementTable{{Step: money.New(1)}},
+		})
+		m.leiloes.Store(ids[i], m.newActor(status))
+	}
+	return m, ids
+}
+
+// BenchmarkMakeBid mede lances por segundo com todos os núcleos dando lances
+// ao mesmo tempo, espalhados por um número crescente de leilões. Com um leilão
+// todos disputam a mesma goroutine e cada lance paga um fsync; com mais
+// leilões os lances rodam em paralelo, dividem o fsync e o ns/op deve cair
+func BenchmarkMakeBid(b *testing.B) {
+	for _, leiloes := range []int{1, 16, 256, 4096} {
+		b.Run(fmt.Sprintf("auctions=%d", leiloes), func(b *testing.B) {
+			m, ids := benchMSLance(b, leiloes)
+
+			var seq atomic.Int64
+			// muitos clientes por núcleo, como em produção: enquanto os lances
+			// de um leilão esperam o fsync, os dos outros entram no mesmo lote
+			b.SetParallelism(64)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					n := seq.Add(1)
+					// o valor cresce junto com seq, então quase todo lance é aceito
+					m.MakeBid(models.LanceRealizado{
+						LeilaoID: ids[int(n)%len(ids)],
+						UserID:   fmt.Sprintf("user-%d", n%64),
+						Valor:    money.New(n * 100),
+					})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkGetHighestBid mede a leitura do snapshot enquanto um leilão quente
+// recebe lances sem parar
+func BenchmarkGetHighestBid(b *testing.B) {
+	m, ids := benchMSLance(b, 1)
+
+	parar := make(chan struct{})
+	defer close(parar)
+	go func() {
+		for n := int64(1); ; n++ {
+			select {
+			case <-parar:
+				return
+			default:
+			}
+			m.MakeBid(models.LanceRealizado{LeilaoID: ids[0], UserID: fmt.Sprintf("user-%d", n%2), Valor: money.New(n * 100)})
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := m.GetHighestBid(ids[0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
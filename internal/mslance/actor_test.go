@@ -0,0 +1,47 @@
+package mslance
+
+import (
+	"auction-system/pkg/money"
+	"testing"
+	"time"
+)
+
+// TestSendThenAfterPersist garante que o depois de sendThen só roda com o
+// estado gravado, na ordem de envio, e que um leilão ocupado não segura outro
+func TestSendThenAfterPersist(t *testing.T) {
+	gravados := make(chan money.Money, 10)
+	persist := func(s LeilaoStatus) { gravados <- s.MaiorLance }
+
+	lento := newLeilaoActor(&LeilaoStatus{ID: "lento"}, func(LeilaoStatus) {})
+	solta := make(chan struct{})
+	lento.send(func(*LeilaoStatus) { <-solta })
+	defer close(solta)
+
+	a := newLeilaoActor(&LeilaoStatus{ID: "rapido"}, persist)
+	ordem := make(chan money.Money, 10)
+	for _, v := range []int64{100, 200} {
+		valor := money.New(v)
+		a.sendThen(func(leilao *LeilaoStatus) {
+			leilao.MaiorLance = valor
+		}, func() {
+			if g := <-gravados; g != valor {
+				t.Errorf("depois ran before persisting %v (persisted %v)", valor, g)
+			}
+			if s := a.snapshot.Load(); s.highest.MaiorLance != valor {
+				t.Errorf("snapshot = %v, want %v", s.highest.MaiorLance, valor)
+			}
+			ordem <- valor
+		})
+	}
+
+	for _, want := range []int64{100, 200} {
+		select {
+		case got := <-ordem:
+			if got != money.New(want) {
+				t.Fatalf("got %v, want %v", got, money.New(want))
+			}
+		case <-time.After(time.Second):
+			t.Fatal("bid blocked behind another auction")
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"errors"
+	"log"
+)
+
+var ErrAuctionNotFound = errors.New("leilão não encontrado")
+
+// CompraImediataDisponivel diz se o leilão ainda oferece a compra imediata:
+// até o primeiro lance, ou enquanto os lances não chegam ao limite configurado
+func (l *LeilaoStatus) CompraImediataDisponivel() bool {
+	if l.BuyNowPrice.IsZero() {
+		return false
+	}
+	return l.Vencedor == "" || l.MaiorLance.LessThan(l.BuyNowThreshold)
+}
+
+// BuyNow arremata o leilão pelo preço de compra imediata, depois de passar pela
+// cadeia de regras da compra (veja DefaultBuyNowRules). O leilao.vencedor
+// publicado aqui chega ao msleilao com o leilão ainda ativo, e é lá que ele é
+// encerrado e o timer de fim descartado
+func (m *MSLance) BuyNow(auctionID string, userID string) error {
+	a, ok := m.actor(auctionID)
+	if !ok {
+		return ErrAuctionNotFound
+	}
+
+	var err error
+	a.call(func(leilao *LeilaoStatus) {
+		if rej := m.buyNow(leilao, userID); rej != nil {
+			err = rej
+		}
+	})
+	return err
+}
+
+func (m *MSLance) buyNow(leilao *LeilaoStatus, userID string) *Rejeicao {
+	auctionID := leilao.ID
+	bid := models.LanceRealizado{LeilaoID: auctionID, UserID: userID, Valor: leilao.BuyNowPrice}
+	m.expirar(leilao)
+	for _, regra := range m.regrasCompra {
+		if rej := regra.Check(leilao, bid); rej != nil {
+			log.Printf("Compra imediata de %s recusada (%s): %s (leilão %s)", userID, rej.Codigo, rej.Motivo, auctionID)
+			m.recordBid(leilao, bid, BidKindBuyNow, leilao.BuyNowPrice, rej)
+			return rej
+		}
+	}
+	m.recordBid(leilao, bid, BidKindBuyNow, leilao.BuyNowPrice, nil)
+
+	anterior := leilao.Vencedor
+	leilao.MaiorLance = leilao.BuyNowPrice
+	leilao.Vencedor = userID
+	leilao.MaximoVencedor = money.Money{}
+
+	log.Printf("Compra imediata por %s (leilão %s)", userID, auctionID)
+
+	// o leilão acaba aqui; desativado antes do lance.validado, ele não é prorrogado
+	leilao.Ativo = false
+	m.publishValidado(leilao)
+	m.notifyLiderTrocado(leilao, anterior)
+	m.closeLeilao(leilao)
+
+	return nil
+}
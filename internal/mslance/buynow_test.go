@@ -0,0 +1,60 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"testing"
+)
+
+func TestBuyNowRules(t *testing.T) {
+	h := newLanceHarness(t)
+	h.SetBuyNowRules(DefaultBuyNowRules([]string{"bloqueado"}))
+	id := h.start(t, models.LeilaoIniciado{
+		StartingPrice:   money.New(1000),
+		BuyNowPrice:     money.New(10000),
+		BuyNowThreshold: money.New(5000),
+		SellerID:        "vendedor",
+		MaxBidsPerUser:  1,
+	})
+
+	if err := h.BuyNow(id, "vendedor"); codigo(err) != models.RejeicaoVendedor {
+		t.Errorf("seller = %v, want %s", err, models.RejeicaoVendedor)
+	}
+	if err := h.BuyNow(id, "bloqueado"); codigo(err) != models.RejeicaoUsuarioBloqueado {
+		t.Errorf("blocked user = %v, want %s", err, models.RejeicaoUsuarioBloqueado)
+	}
+
+	// A já usou o único lance permitido
+	if err := h.bid(id, "A", 1000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.BuyNow(id, "A"); codigo(err) != models.RejeicaoLimiteLances {
+		t.Errorf("A = %v, want %s", err, models.RejeicaoLimiteLances)
+	}
+
+	if err := h.BuyNow(id, "B"); err != nil {
+		t.Fatalf("B: %v", err)
+	}
+	// a compra encerra o leilão na hora
+	var vencedores []models.LeilaoVencedor
+	h.pub.take(t, "leilao.vencedor", &vencedores)
+	if len(vencedores) != 1 || vencedores[0].UserID != "B" || !vencedores[0].Valor.Equal(money.New(10000)) {
+		t.Errorf("winners = %+v, want B at the buy now price", vencedores)
+	}
+}
+
+func TestBuyNowUnavailableAboveThreshold(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{
+		StartingPrice:   money.New(1000),
+		BuyNowPrice:     money.New(10000),
+		BuyNowThreshold: money.New(5000),
+	})
+
+	if err := h.bid(id, "A", 6000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.BuyNow(id, "B"); codigo(err) != models.RejeicaoCompraIndisponivel {
+		t.Errorf("B = %v, want %s", err, models.RejeicaoCompraIndisponivel)
+	}
+}
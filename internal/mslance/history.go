@@ -0,0 +1,205 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	BidAccepted = "accepted"
+	BidRejected = "rejected"
+)
+
+const (
+	BidKindManual = "bid"
+	BidKindProxy  = "proxy"
+	BidKindBuyNow = "buy_now"
+)
+
+// BidRecord é um lance como ficou no histórico. O lance máximo do lance
+// automático não é guardado, só que ele existia. Fora do mslance o UserID só
+// aparece para administradores; veja Anonimizado
+type BidRecord struct {
+	Seq        int64       `json:"seq"`
+	BidID      string      `json:"bid_id,omitempty"`
+	LeilaoID   string      `json:"leilao_id"`
+	UserID     string      `json:"user_id,omitempty"`
+	Pseudonimo string      `json:"pseudonimo,omitempty"`
+	Valor      money.Money `json:"valor"`
+	Quantidade int         `json:"quantidade,omitempty"`
+	Kind       string      `json:"kind"`
+	Status     string      `json:"status"`
+	Motivo     string      `json:"motivo,omitempty"`
+	// Codigo é o código da recusa, estável para os clientes
+	Codigo    models.CodigoRejeicao `json:"codigo,omitempty"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
+// BidHistory guarda todos os lances recebidos, aceitos ou não
+type BidHistory interface {
+	// Append numera o lance na sequência do leilão e o persiste
+	Append(rec BidRecord) (BidRecord, error)
+	// List devolve os lances do leilão do mais novo para o mais antigo, a
+	// partir de offset, e o total de lances do leilão
+	List(leilaoID string, offset, limit int) ([]BidRecord, int, error)
+}
+
+// FileBidHistory mantém o histórico em memória e acrescenta cada lance a um
+// arquivo JSON Lines. Como o arquivo só cresce, não é preciso regravá-lo. Cada
+// leilão tem o próprio lock; o arquivo é aberto com O_APPEND, então cada linha
+// vai inteira para o fim mesmo com leilões escrevendo ao mesmo tempo.
+//
+// Append não faz fsync: o histórico é um registro de auditoria, e o estado que
+// decide o leilão (maior lance, vencedor, créditos) vai para o StateStore, que
+// faz fsync a cada alteração. Um crash da máquina pode perder as últimas linhas
+// do histórico sem mudar o resultado de nenhum leilão; um fsync por lance aqui
+// dobraria o custo de cada lance para proteger só a auditoria
+type FileBidHistory struct {
+	file *os.File
+	// leiloes guarda um *historicoLeilao por leilão
+	leiloes sync.Map
+}
+
+type historicoLeilao struct {
+	mu      sync.RWMutex
+	records []BidRecord
+}
+
+func NewFileBidHistory(path string) (*FileBidHistory, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+
+	h := &FileBidHistory{}
+
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec BidRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				// uma linha cortada por um crash no meio da escrita é descartada
+				continue
+			}
+			hl := h.leilao(rec.LeilaoID)
+			hl.records = append(hl.records, rec)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+	}
+
+	h.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	return h, nil
+}
+
+func (h *FileBidHistory) leilao(leilaoID string) *historicoLeilao {
+	if hl, ok := h.leiloes.Load(leilaoID); ok {
+		return hl.(*historicoLeilao)
+	}
+	hl, _ := h.leiloes.LoadOrStore(leilaoID, &historicoLeilao{})
+	return hl.(*historicoLeilao)
+}
+
+func (h *FileBidHistory) Append(rec BidRecord) (BidRecord, error) {
+	hl := h.leilao(rec.LeilaoID)
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	rec.Seq = int64(len(hl.records) + 1)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return BidRecord{}, fmt.Errorf("failed to encode bid: %w", err)
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return BidRecord{}, fmt.Errorf("failed to write bid: %w", err)
+	}
+
+	hl.records = append(hl.records, rec)
+	return rec, nil
+}
+
+func (h *FileBidHistory) List(leilaoID string, offset, limit int) ([]BidRecord, int, error) {
+	v, ok := h.leiloes.Load(leilaoID)
+	if !ok {
+		return []BidRecord{}, 0, nil
+	}
+	hl := v.(*historicoLeilao)
+	hl.mu.RLock()
+	defer hl.mu.RUnlock()
+
+	all := hl.records
+	total := len(all)
+
+	page := []BidRecord{}
+	for i := total - 1 - max(offset, 0); i >= 0 && len(page) < limit; i-- {
+		page = append(page, all[i])
+	}
+	return page, total, nil
+}
+
+func (h *FileBidHistory) Close() error {
+	return h.file.Close()
+}
+
+// ErrHistorySealed impede que o histórico revele propostas de um leilão
+// selado antes do fechamento
+var ErrHistorySealed = errors.New("histórico de leilão selado só é liberado após o fechamento")
+
+// BidHistory devolve uma página do histórico de lances do leilão, do mais
+// novo para o mais antigo, e o total de lances
+func (m *MSLance) BidHistory(auctionID string, offset, limit int) ([]BidRecord, int, error) {
+	if a, ok := m.actor(auctionID); ok {
+		if s := a.snapshot.Load(); s.ativo && s.selado {
+			return nil, 0, ErrHistorySealed
+		}
+	}
+	return m.history.List(auctionID, offset, limit)
+}
+
+// recordBid registra o resultado de um lance no histórico. Falhas de escrita
+// não derrubam o lance, só ficam no log. Deve ser chamada na goroutine do leilão
+func (m *MSLance) recordBid(leilao *LeilaoStatus, bid models.LanceRealizado, kind string, valor money.Money, err error) {
+	rec := BidRecord{
+		BidID:      bid.BidID,
+		LeilaoID:   bid.LeilaoID,
+		UserID:     bid.UserID,
+		Pseudonimo: leilao.pseudonimo(bid.UserID),
+		Valor:      valor,
+		Quantidade: bid.Quantidade,
+		Kind:       kind,
+		Status:     BidAccepted,
+		Timestamp:  m.clock.Now(),
+	}
+	if err != nil {
+		rec.Status = BidRejected
+		rec.Motivo = err.Error()
+		var rej *Rejeicao
+		if errors.As(err, &rej) {
+			rec.Codigo = rej.Codigo
+			rec.Motivo = rej.motivoPublico()
+		}
+	}
+
+	if _, err := m.history.Append(rec); err != nil {
+		log.Printf("Erro ao gravar histórico do leilão %s: %v", bid.LeilaoID, err)
+	}
+}
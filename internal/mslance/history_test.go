@@ -0,0 +1,107 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func seqs(recs []BidRecord) []int64 {
+	var s []int64
+	for _, r := range recs {
+		s = append(s, r.Seq)
+	}
+	return s
+}
+
+// TestFileBidHistoryList confere a paginação do mais novo para o mais antigo,
+// inclusive páginas vazias além do total e com limit 0
+func TestFileBidHistoryList(t *testing.T) {
+	h, err := NewFileBidHistory(filepath.Join(t.TempDir(), "bids.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	id := models.NewAuctionID()
+	for i := 1; i <= 5; i++ {
+		if _, err := h.Append(BidRecord{LeilaoID: id, Valor: money.New(int64(i * 100))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []int64
+	}{
+		{"first page", 0, 2, []int64{5, 4}},
+		{"last partial page", 4, 2, []int64{1}},
+		{"offset at total", 5, 2, nil},
+		{"offset past total", 50, 2, nil},
+		{"limit zero", 0, 0, nil},
+		{"negative offset", -3, 2, []int64{5, 4}},
+	}
+	for _, tt := range tests {
+		page, total, err := h.List(id, tt.offset, tt.limit)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if total != 5 || page == nil || !slices.Equal(seqs(page), tt.want) {
+			t.Errorf("%s: List(%d, %d) = %v (total %d), want %v (total 5)", tt.name, tt.offset, tt.limit, seqs(page), total, tt.want)
+		}
+	}
+
+	if page, total, _ := h.List(models.NewAuctionID(), 0, 10); len(page) != 0 || total != 0 {
+		t.Errorf("unknown auction = %v (total %d), want empty", page, total)
+	}
+}
+
+// TestFileBidHistoryReload confere que reabrir o arquivo recupera os lances de
+// cada leilão, ignora uma linha cortada e continua a numeração
+func TestFileBidHistoryReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bids.jsonl")
+	h, err := NewFileBidHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := models.NewAuctionID(), models.NewAuctionID()
+	for _, id := range []string{a, b, a} {
+		if _, err := h.Append(BidRecord{LeilaoID: id, UserID: "A", Status: BidAccepted}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Close()
+
+	// uma linha cortada por um crash no meio da escrita
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":3,"leilao_id":"` + a)
+	f.Close()
+
+	h, err = NewFileBidHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if page, total, _ := h.List(a, 0, 10); total != 2 || !slices.Equal(seqs(page), []int64{2, 1}) || page[0].UserID != "A" {
+		t.Fatalf("auction a after reload = %+v (total %d), want seqs 2 and 1", page, total)
+	}
+	if _, total, _ := h.List(b, 0, 10); total != 1 {
+		t.Fatalf("auction b after reload has %d bids, want 1", total)
+	}
+
+	rec, err := h.Append(BidRecord{LeilaoID: a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Seq != 3 {
+		t.Errorf("next seq after reload = %d, want 3", rec.Seq)
+	}
+}
@@ -0,0 +1,96 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"errors"
+)
+
+// maxProcessados limita quantos bid_ids cada leilão lembra. Uma retentativa
+// chega segundos depois do lance original, muito antes de ele ser descartado
+const maxProcessados = 1024
+
+var ErrBidIDReused = errors.New("bid_id já foi usado em outro lance")
+
+// BidResult acompanha o resultado de MakeBid. Replayed indica que o lance já
+// tinha sido processado e o resultado devolvido é o da primeira tentativa
+type BidResult struct {
+	BidID    string `json:"bid_id,omitempty"`
+	Replayed bool   `json:"replayed,omitempty"`
+}
+
+// lanceProcessado guarda o lance e o resultado para responder retentativas
+// com o mesmo bid_id sem processar nada de novo. O erro vira texto para que
+// sobreviva a um restart junto com o resto do estado
+type lanceProcessado struct {
+	Lance  models.LanceRealizado `json:"lance"`
+	Erro   string                `json:"erro,omitempty"`
+	Codigo models.CodigoRejeicao `json:"codigo,omitempty"`
+}
+
+// replay procura um lance já processado com o mesmo bid_id. Um bid_id
+// repetido com outro conteúdo é recusado. Deve ser chamada na goroutine do leilão
+func (l *LeilaoStatus) replay(bid models.LanceRealizado) (bool, error) {
+	if bid.BidID == "" {
+		return false, nil
+	}
+
+	anterior, ok := l.Processados[bid.BidID]
+	if !ok {
+		return false, nil
+	}
+	if !mesmoLance(anterior.Lance, bid) {
+		return false, ErrBidIDReused
+	}
+	if anterior.Codigo != "" {
+		return true, &Rejeicao{Codigo: anterior.Codigo, Motivo: anterior.Erro}
+	}
+	if anterior.Erro != "" {
+		return true, errors.New(anterior.Erro)
+	}
+	return true, nil
+}
+
+// mesmoLance compara os valores com Equal: depois de gravado e lido, um valor
+// zero volta com a moeda preenchida
+func mesmoLance(a, b models.LanceRealizado) bool {
+	return a.BidID == b.BidID &&
+		a.LeilaoID == b.LeilaoID &&
+		a.UserID == b.UserID &&
+		a.Valor.Equal(b.Valor) &&
+		a.ValorMaximo.Equal(b.ValorMaximo) &&
+		a.Quantidade == b.Quantidade
+}
+
+// lembrar guarda o resultado do lance para as retentativas, descartando o
+// mais antigo quando o leilão já lembra maxProcessados lances
+func (l *LeilaoStatus) lembrar(bid models.LanceRealizado, err error) {
+	if bid.BidID == "" {
+		return
+	}
+	if l.Processados == nil {
+		l.Processados = make(map[string]lanceProcessado)
+	}
+	if len(l.OrdemProcessados) != len(l.Processados) {
+		// estado gravado antes de existir a ordem; os antigos saem em qualquer ordem
+		l.OrdemProcessados = l.OrdemProcessados[:0]
+		for id := range l.Processados {
+			l.OrdemProcessados = append(l.OrdemProcessados, id)
+		}
+	}
+	for len(l.OrdemProcessados) >= maxProcessados {
+		delete(l.Processados, l.OrdemProcessados[0])
+		l.OrdemProcessados = l.OrdemProcessados[1:]
+	}
+	if _, ok := l.Processados[bid.BidID]; !ok {
+		l.OrdemProcessados = append(l.OrdemProcessados, bid.BidID)
+	}
+	processado := lanceProcessado{Lance: bid}
+	if err != nil {
+		processado.Erro = err.Error()
+	}
+	var rej *Rejeicao
+	if errors.As(err, &rej) {
+		processado.Codigo = rej.Codigo
+	}
+	l.Processados[bid.BidID] = processado
+}
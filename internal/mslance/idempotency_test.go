@@ -0,0 +1,110 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBidReplay(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+
+	lance := models.LanceRealizado{BidID: "bid-1", LeilaoID: id, UserID: "A", Valor: money.New(1000)}
+	if res, err := h.MakeBid(lance); err != nil || res.Replayed {
+		t.Fatalf("first attempt = %+v, %v, want a fresh accepted bid", res, err)
+	}
+
+	res, err := h.MakeBid(lance)
+	if err != nil || !res.Replayed || res.BidID != "bid-1" {
+		t.Fatalf("retry = %+v, %v, want the original result replayed", res, err)
+	}
+
+	if _, total, _ := h.history.List(id, 0, 10); total != 1 {
+		t.Errorf("history has %d records, want the retry not recorded", total)
+	}
+	var validados []models.LanceValidado
+	h.pub.take(t, "lance.validado", &validados)
+	if len(validados) != 1 {
+		t.Errorf("published %d lance.validado, want 1", len(validados))
+	}
+
+	outro := lance
+	outro.Valor = money.New(2000)
+	if _, err := h.MakeBid(outro); !errors.Is(err, ErrBidIDReused) {
+		t.Errorf("same bid_id with another value = %v, want ErrBidIDReused", err)
+	}
+}
+
+func TestBidReplayKeepsRejection(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+
+	lance := models.LanceRealizado{BidID: "bid-1", LeilaoID: id, UserID: "A", Valor: money.New(500)}
+	_, first := h.MakeBid(lance)
+	if codigo(first) != models.RejeicaoAbaixoMinimo {
+		t.Fatalf("first attempt = %v, want below_minimum", first)
+	}
+
+	// o leilão mudou, mas a retentativa devolve a recusa original
+	if err := h.bid(id, "B", 3000, 0); err != nil {
+		t.Fatal(err)
+	}
+	res, err := h.MakeBid(lance)
+	if !res.Replayed || codigo(err) != models.RejeicaoAbaixoMinimo || err.Error() != first.Error() {
+		t.Fatalf("retry = %+v, %v, want the original rejection replayed", res, err)
+	}
+}
+
+func TestBidReplaySurvivesRestart(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+
+	lance := models.LanceRealizado{BidID: "bid-1", LeilaoID: id, UserID: "A", Valor: money.New(1000)}
+	if _, err := h.MakeBid(lance); err != nil {
+		t.Fatal(err)
+	}
+
+	// o estado passa pelo JSON do StateStore, onde o valor máximo zero volta com moeda
+	a, _ := h.actor(id)
+	var status LeilaoStatus
+	a.call(func(l *LeilaoStatus) {
+		data, _ := json.Marshal(l)
+		json.Unmarshal(data, &status)
+	})
+
+	restarted := newLanceHarness(t)
+	restarted.leiloes.Store(id, restarted.newActor(&status))
+	if res, err := restarted.MakeBid(lance); err != nil || !res.Replayed {
+		t.Fatalf("retry after restart = %+v, %v, want the original result replayed", res, err)
+	}
+}
+
+func TestBidReplayForgetsOldest(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+
+	lance := func(n int) models.LanceRealizado {
+		return models.LanceRealizado{BidID: fmt.Sprintf("bid-%d", n), LeilaoID: id, UserID: "A", Valor: money.New(1)}
+	}
+	for n := range maxProcessados + 1 {
+		h.MakeBid(lance(n))
+	}
+
+	a, _ := h.actor(id)
+	a.call(func(l *LeilaoStatus) {
+		if len(l.Processados) != maxProcessados || len(l.OrdemProcessados) != maxProcessados {
+			t.Errorf("remembers %d bids (%d in order), want %d", len(l.Processados), len(l.OrdemProcessados), maxProcessados)
+		}
+	})
+
+	if res, _ := h.MakeBid(lance(0)); res.Replayed {
+		t.Error("the oldest bid_id should have been forgotten")
+	}
+	if res, _ := h.MakeBid(lance(maxProcessados)); !res.Replayed {
+		t.Error("the newest bid_id should still be replayed")
+	}
+}
@@ -0,0 +1,107 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/rabbitmq"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// resultadoLance traduz o retorno de MakeBid para a resposta enviada pela fila
+func resultadoLance(bid models.LanceRealizado, result BidResult, err error) models.ResultadoLance {
+	resultado := models.ResultadoLance{
+		BidID:    result.BidID,
+		LeilaoID: bid.LeilaoID,
+		UserID:   bid.UserID,
+		Status:   models.LanceAceito,
+		Replayed: result.Replayed,
+	}
+	if err != nil {
+		resultado.Status = models.LanceRecusado
+		if errors.Is(err, ErrBidIDReused) {
+			resultado.Status = models.LanceConflito
+		}
+		resultado.Erro = err.Error()
+		var rej *Rejeicao
+		if errors.As(err, &rej) {
+			resultado.Codigo = rej.Codigo
+		}
+	}
+	return resultado
+}
+
+// prefetchLances é quantos lances o mslance aceita da fila sem ter confirmado.
+// Os lances de leilões diferentes são processados ao mesmo tempo até esse limite
+const prefetchLances = 256
+
+// ListenLanceRealizado consome os lances publicados pelo gateway em
+// lance.realizado, em ch, um canal só dele: o prefetch vale por canal e não
+// deve limitar os outros consumidores. Cada lance vai para a goroutine do seu
+// leilão sem esperar os anteriores, então leilões diferentes andam em paralelo,
+// e a fila de cada leilão mantém a ordem de chegada dentro dele. O ack só sai
+// depois que o estado foi gravado: se o mslance cair no meio, o lance volta
+// para a fila e o bid_id evita que ele seja aplicado duas vezes. Quando a
+// mensagem traz reply-to o resultado também é respondido direto para quem
+// publicou; sem ele o cliente acompanha lance.validado e lance.invalidado
+func (m *MSLance) ListenLanceRealizado(ch *amqp.Channel) {
+	if err := ch.Qos(prefetchLances, 0, false); err != nil {
+		log.Printf("Erro ao configurar prefetch de lance_realizado: %v", err)
+	}
+
+	msgs, err := ch.Consume("lance_realizado", "", false, false, false, false, nil)
+	if err != nil {
+		log.Printf("Erro ao consumir lance_realizado: %v", err)
+		return
+	}
+
+	go func() {
+		for d := range msgs {
+			var bid models.LanceRealizado
+			if err := json.Unmarshal(d.Body, &bid); err != nil {
+				log.Printf("Lance mal formado descartado: %v", err)
+				d.Nack(false, false)
+				continue
+			}
+			if bid.BidID == "" {
+				bid.BidID = d.CorrelationId
+			}
+
+			a, ok := m.actor(bid.LeilaoID)
+			if !ok {
+				log.Printf("Leilão %s não encontrado", bid.LeilaoID)
+				err := fmt.Errorf("leilão %s não encontrado", bid.LeilaoID)
+				responderLance(ch, d, bid, BidResult{BidID: bid.BidID}, err)
+				continue
+			}
+
+			var result BidResult
+			var bidErr error
+			a.sendThen(func(leilao *LeilaoStatus) {
+				result, bidErr = m.processarLance(leilao, bid)
+			}, func() {
+				responderLance(ch, d, bid, result, bidErr)
+			})
+		}
+	}()
+}
+
+// responderLance responde para quem publicou o lance, se ele pediu, e
+// confirma a mensagem
+func responderLance(ch *amqp.Channel, d amqp.Delivery, bid models.LanceRealizado, result BidResult, err error) {
+	if err != nil {
+		log.Printf("Lance %s recusado pela fila: %v", bid.BidID, err)
+	}
+
+	if d.ReplyTo != "" {
+		body, _ := json.Marshal(resultadoLance(bid, result, err))
+		if err := rabbitmq.Reply(ch, d.ReplyTo, d.CorrelationId, body); err != nil {
+			log.Printf("Erro ao responder lance %s: %v", bid.BidID, err)
+		}
+	}
+
+	d.Ack(false)
+}
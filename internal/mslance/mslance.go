@@ -1,37 +1,189 @@
 package mslance
 
 import (
+	"auction-system/pkg/clock"
 	"auction-system/pkg/models"
+	"auction-system/pkg/money"
 	"auction-system/pkg/rabbitmq"
 	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type LeilaoStatus struct {
-	ID         string
-	Descricao  string
-	Ativo      bool
-	MaiorLance float64
+	ID        string
+	Descricao string
+	Ativo     bool
+	Cancelado bool
+	// Encerrado indica que o resultado do leilão já foi publicado
+	Encerrado  bool
+	Fim        time.Time
+	MaiorLance money.Money
 	Vencedor   string
+	// MaximoVencedor é o lance máximo (proxy) do líder atual. Nunca é publicado,
+	// só gravado no StateStore do próprio mslance
+	MaximoVencedor money.Money
+	// ReservePrice é o mínimo oculto do vendedor, conferido só no fechamento
+	ReservePrice  money.Money
+	StartingPrice money.Money
+	Increments    models.IncrementTable
+	Tipo          models.AuctionType
+	// PrecoAtual é o preço corrente do leilão holandês
+	PrecoAtual money.Money
+	// Quantidade é o número de unidades idênticas do lote
+	Quantidade int
+	// CeilingPrice é o preço teto do leilão reverso
+	CeilingPrice money.Money
+	Penny        *models.PennyParams
+	// SoftCloseWindow e SoftCloseExtension, em segundos, aplicam o soft close
+	// (veja prorrogar)
+	SoftCloseWindow    int
+	SoftCloseExtension int
+	// BuyNowPrice some quando os lances chegam a BuyNowThreshold
+	BuyNowPrice     money.Money
+	BuyNowThreshold money.Money
+	// Propostas guarda um lance por usuário nos leilões selados e nos de várias unidades
+	Propostas []Proposta
+	// SellerID e MaxBidsPerUser vêm do leilao.iniciado e alimentam as regras
+	SellerID       string
+	MaxBidsPerUser int
+	// LancesPorUsuario conta os lances aceitos de cada participante
+	LancesPorUsuario map[string]int
+	// Pseudonimos é o apelido público de cada participante, o único que sai
+	// nos eventos para a sala e no histórico
+	Pseudonimos map[string]string
+	// Processados guarda os últimos maxProcessados lances tratados, por bid_id.
+	// OrdemProcessados tem os mesmos bid_ids na ordem em que chegaram, para
+	// descartar os mais antigos
+	Processados      map[string]lanceProcessado
+	OrdemProcessados []string
+}
+
+type Proposta struct {
+	UserID     string
+	Valor      money.Money
+	Quantidade int
+	Timestamp  time.Time
+}
+
+// lanceMinimoAbsoluto é o menor lance aceito quando não há preço inicial
+var lanceMinimoAbsoluto = money.New(1)
+
+// ProximoLanceMinimo é o menor valor aceito para o próximo lance: o preço
+// inicial enquanto ninguém deu lance, depois o maior lance mais o incremento
+// da faixa em que ele está
+func (l *LeilaoStatus) ProximoLanceMinimo() (money.Money, error) {
+	if l.Penny != nil {
+		base := l.StartingPrice
+		if l.Vencedor != "" {
+			base = l.MaiorLance
+		}
+		return base.Add(l.Penny.Increment)
+	}
+	if l.Quantidade > 1 {
+		return l.minimoMultiUnidade("", 1)
+	}
+	if l.Vencedor == "" || l.Tipo.Sealed() {
+		return money.Max(l.StartingPrice, lanceMinimoAbsoluto), nil
+	}
+	return l.maisIncremento(l.MaiorLance)
+}
+
+// maisIncremento soma ao valor o incremento da faixa em que ele está
+func (l *LeilaoStatus) maisIncremento(v money.Money) (money.Money, error) {
+	return v.Add(l.Increments.StepFor(v))
+}
+
+type HighestBid struct {
+	MaiorLance         money.Money
+	ProximoLanceMinimo money.Money
+	// Reverso indica que os lances descem: vale ProximoLanceMaximo, e não
+	// ProximoLanceMinimo
+	Reverso bool
+	// ProximoLanceMaximo só é preenchido no leilão reverso. Fica zerado quando
+	// o menor lance já não pode ser coberto
+	ProximoLanceMaximo money.Money
+	// BuyNowPrice é zero quando a compra imediata não está mais disponível
+	BuyNowPrice money.Money
+	Fim         time.Time
 }
 
 type MSLance struct {
-	ch      *amqp.Channel
-	leiloes map[string]*LeilaoStatus
-	mu      sync.Mutex
+	ch    *amqp.Channel
+	pub   Publisher
+	clock clock.Clock
+	// leiloes guarda um *leilaoActor por leilão
+	leiloes sync.Map
+	// creditos é o saldo de cada usuário para os leilões de centavos. É o
+	// único estado compartilhado entre leilões e tem o próprio lock
+	creditos map[string]int
+	// compras são as compras de créditos já aplicadas, por transaction_id
+	compras    map[string]bool
+	creditosMu sync.Mutex
+	history    BidHistory
+	store      StateStore
+	// regras é a cadeia de validação de lances de cada tipo de leilão
+	regras BidRules
+	// regrasCompra é a cadeia da compra imediata
+	regrasCompra []BidRule
+}
+
+func NewMSLance(ch *amqp.Channel, clk clock.Clock, history BidHistory, store StateStore) *MSLance {
+	m := newMSLance(amqpPublisher{ch: ch}, clk, history, store)
+	m.ch = ch
+	return m
 }
 
-func NewMSLance(ch *amqp.Channel) *MSLance {
+func newMSLance(pub Publisher, clk clock.Clock, history BidHistory, store StateStore) *MSLance {
 	return &MSLance{
-		ch:      ch,
-		leiloes: make(map[string]*LeilaoStatus),
+		pub:      pub,
+		clock:    clk,
+		history:  history,
+		store:    store,
+		creditos: make(map[string]int),
+		compras:  make(map[string]bool),
+		regras:   DefaultBidRules(nil),
+
+		regrasCompra: DefaultBuyNowRules(nil),
 	}
 }
 
+// SetBidRules troca as regras de validação de lances. Deve ser chamada antes
+// dos Listen*
+func (m *MSLance) SetBidRules(regras BidRules) {
+	m.regras = regras
+}
+
+// SetBuyNowRules troca as regras da compra imediata. Como SetBidRules, deve
+// ser chamada antes dos Listen*
+func (m *MSLance) SetBuyNowRules(regras []BidRule) {
+	m.regrasCompra = regras
+}
+
+func (m *MSLance) newActor(status *LeilaoStatus) *leilaoActor {
+	return newLeilaoActor(status, m.saveLeilao)
+}
+
+// saveLeilao grava o estado do leilão. Uma falha não derruba o lance, só fica
+// no log, como no histórico
+func (m *MSLance) saveLeilao(status LeilaoStatus) {
+	if err := m.store.SaveLeilao(status); err != nil {
+		log.Printf("Erro ao gravar estado do leilão %s: %v", status.ID, err)
+	}
+}
+
+func (m *MSLance) actor(auctionID string) (*leilaoActor, bool) {
+	a, ok := m.leiloes.Load(auctionID)
+	if !ok {
+		return nil, false
+	}
+	return a.(*leilaoActor), true
+}
+
 // Inicializa a exchange e faz o binding das filas
 func (m *MSLance) DeclareExchangeAndQueues() {
 	rabbitmq.DeclareExchange(m.ch, "leilao_events", "topic")
@@ -57,118 +209,582 @@ func (m *MSLance) DeclareExchangeAndQueues() {
 	rabbitmq.DeclareQueue(m.ch, "mspag_leilao_vencedor")
 	rabbitmq.BindQueueToExchange(m.ch, "mspag_leilao_vencedor", "leilao.vencedor", "leilao_events")
 
+	rabbitmq.DeclareQueue(m.ch, "mslance_leilao_cancelado")
+	rabbitmq.BindQueueToExchange(m.ch, "mslance_leilao_cancelado", "leilao.cancelado", "leilao_events")
+
+	rabbitmq.DeclareQueue(m.ch, "mslance_leilao_atualizado")
+	rabbitmq.BindQueueToExchange(m.ch, "mslance_leilao_atualizado", "leilao.atualizado", "leilao_events")
+
+	rabbitmq.DeclareQueue(m.ch, "mslance_leilao_preco_atualizado")
+	rabbitmq.BindQueueToExchange(m.ch, "mslance_leilao_preco_atualizado", "leilao.preco_atualizado", "leilao_events")
+
+	rabbitmq.DeclareQueue(m.ch, "mslance_creditos_adquiridos")
+	rabbitmq.BindQueueToExchange(m.ch, "mslance_creditos_adquiridos", "creditos.adquiridos", "leilao_events")
+
 	rabbitmq.DeclareQueue(m.ch, "cliente_registrado")
 	rabbitmq.BindQueueToExchange(m.ch, "cliente_registrado", "cliente.registrado", "leilao_events")
 }
 
-func (m *MSLance) MakeBid(bid models.LanceRealizado) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	leilao, ok := m.leiloes[bid.LeilaoID]
+// MakeBid processa um lance na goroutine do leilão e espera o resultado. Um
+// lance repetido com o mesmo bid_id não é processado de novo: devolve o
+// resultado da primeira vez, sem publicar nada
+func (m *MSLance) MakeBid(bid models.LanceRealizado) (BidResult, error) {
+	a, ok := m.actor(bid.LeilaoID)
 	if !ok {
 		log.Printf("Leilão %s não encontrado", bid.LeilaoID)
-		return fmt.Errorf("leilão %s não encontrado", bid.LeilaoID)
+		return BidResult{BidID: bid.BidID}, fmt.Errorf("leilão %s não encontrado", bid.LeilaoID)
 	}
 
-	if !leilao.Ativo {
-		log.Printf("Leilão %s não está ativo", bid.LeilaoID)
+	var result BidResult
+	var err error
+	a.call(func(leilao *LeilaoStatus) {
+		result, err = m.processarLance(leilao, bid)
+	})
+	return result, err
+}
+
+// processarLance trata o lance na goroutine do leilão: devolve o resultado
+// anterior de um bid_id repetido ou passa o lance pelas regras, e registra o
+// resultado no histórico
+func (m *MSLance) processarLance(leilao *LeilaoStatus, bid models.LanceRealizado) (BidResult, error) {
+	result := BidResult{BidID: bid.BidID}
 
-		invalidado := map[string]interface{}{
-			"leilao_id": bid.LeilaoID,
-			"user_id":   bid.UserID,
-			"valor":     bid.Valor,
-			"motivo":    "Leilão não está ativo",
+	replayed, err := leilao.replay(bid)
+	if replayed || err != nil {
+		if replayed {
+			log.Printf("Lance %s repetido, devolvendo o resultado original (leilão %s)", bid.BidID, bid.LeilaoID)
 		}
-		body, _ := json.Marshal(invalidado)
-		rabbitmq.PublishToExchange(m.ch, "leilao_events", "lance.invalidado", body)
+		result.Replayed = replayed
+		return result, err
+	}
 
-		return fmt.Errorf("leilão %s não está ativo", bid.LeilaoID)
+	kind := BidKindManual
+	if bid.ValorMaximo.IsPositive() {
+		kind = BidKindProxy
 	}
 
-	if bid.Valor <= leilao.MaiorLance {
-		log.Printf("Lance invalidado: %.2f <= %.2f (leilão %s)", bid.Valor, leilao.MaiorLance, bid.LeilaoID)
+	if rej := m.makeBid(leilao, bid); rej != nil {
+		err = rej
+	}
+	m.recordBid(leilao, bid, kind, bid.Valor, err)
+	leilao.lembrar(bid, err)
+	return result, err
+}
 
-		invalidado := map[string]interface{}{
-			"leilao_id": bid.LeilaoID,
-			"user_id":   bid.UserID,
-			"valor":     bid.Valor,
-			"motivo":    fmt.Sprintf("Lance deve ser maior que %.2f", leilao.MaiorLance),
+// makeBid passa o lance pela cadeia de regras do tipo do leilão e, se nenhuma
+// recusar, aplica o lance. Deve ser chamada na goroutine do leilão
+func (m *MSLance) makeBid(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	m.expirar(leilao)
+	rej := m.checkRules(leilao, bid)
+	if rej == nil {
+		rej = m.applyBid(leilao, bid)
+	}
+	if rej != nil {
+		log.Printf("Lance de %s recusado (%s): %s (leilão %s)", bid.UserID, rej.Codigo, rej.Motivo, bid.LeilaoID)
+		m.publishInvalidado(bid, rej)
+		return rej
+	}
+
+	if leilao.LancesPorUsuario == nil {
+		leilao.LancesPorUsuario = make(map[string]int)
+	}
+	leilao.LancesPorUsuario[bid.UserID]++
+	return nil
+}
+
+// expirar desativa o leilão cujo fim já passou no relógio do mslance, sem
+// esperar o leilao.finalizado. Assim nenhum lance é aceito depois do fim, e a
+// prorrogação de um lance aceito sempre parte de um leilão ainda aberto. Deve
+// ser chamada na goroutine do leilão
+func (m *MSLance) expirar(leilao *LeilaoStatus) {
+	if leilao.Ativo && !m.clock.Now().Before(leilao.Fim) {
+		leilao.Ativo = false
+	}
+}
+
+func (m *MSLance) checkRules(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	for _, regra := range m.regras[leilao.Tipo.Normalize()] {
+		if rej := regra.Check(leilao, bid); rej != nil {
+			return rej
 		}
-		body, _ := json.Marshal(invalidado)
-		rabbitmq.PublishToExchange(m.ch, "leilao_events", "lance.invalidado", body)
+	}
+	return nil
+}
 
-		return fmt.Errorf("lance deve ser maior que %.2f", leilao.MaiorLance)
+// applyBid aplica um lance que já passou pelas regras. Ainda pode recusá-lo
+// quando a recusa depende do próprio processamento, como o lance superado
+// pelo máximo do líder ou a falta de créditos. Se a liderança mudou de mãos,
+// o líder anterior recebe lance.superado
+func (m *MSLance) applyBid(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	anterior := leilao.Vencedor
+	rej := m.applyBidByType(leilao, bid)
+	m.notifyLiderTrocado(leilao, anterior)
+	return rej
+}
+
+func (m *MSLance) applyBidByType(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	switch {
+	case leilao.Tipo == models.AuctionDutch:
+		return m.makeDutchBid(leilao, bid)
+	case leilao.Tipo == models.AuctionReverse:
+		return m.makeReverseBid(leilao, bid)
+	case leilao.Tipo == models.AuctionPenny:
+		return m.makePennyBid(leilao, bid)
+	case leilao.Quantidade > 1:
+		return m.makeMultiUnitBid(leilao, bid)
+	case leilao.Tipo.Sealed():
+		return m.makeSealedBid(leilao, bid)
 	}
+	return m.makeEnglishBid(leilao, bid)
+}
 
-	leilao.MaiorLance = bid.Valor
-	leilao.Vencedor = bid.UserID
+// makeEnglishBid aplica o lance do leilão inglês, com o lance automático
+// resolvido por resolveProxy
+func (m *MSLance) makeEnglishBid(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	limite := limiteDoLance(bid)
+
+	if leilao.Vencedor == bid.UserID && bid.ValorMaximo.IsPositive() {
+		// o líder só está subindo o próprio máximo; o preço visível não muda
+		leilao.MaximoVencedor = limite
+		log.Printf("Lance máximo atualizado por %s (leilão %s)", bid.UserID, bid.LeilaoID)
+		return nil
+	}
 
-	bidByte, err := json.Marshal(bid)
+	superado, err := m.resolveProxy(leilao, bid, limite)
 	if err != nil {
-		return err
+		return rejeitarMoeda(err)
+	}
+
+	m.publishValidado(leilao)
+
+	if superado {
+		return rejeitar(models.RejeicaoSuperado, "Seu lance foi superado automaticamente por outro participante")
 	}
+	return nil
+}
+
+// makeDutchBid aceita o primeiro lance que cobre o preço atual do leilão
+// holandês. Quem aceita leva pelo preço anunciado e o leilão acaba na hora
+func (m *MSLance) makeDutchBid(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	leilao.MaiorLance = leilao.PrecoAtual
+	leilao.Vencedor = bid.UserID
+
+	m.publishValidado(leilao)
+	m.closeLeilao(leilao)
 
-	log.Printf("✅ Lance validado: %.2f por %s (leilão %s)", bid.Valor, bid.UserID, bid.LeilaoID)
-	rabbitmq.PublishToExchange(m.ch, "leilao_events", "lance.validado", bidByte)
+	return nil
+}
+
+// makeSealedBid registra ou revisa a proposta confidencial do usuário. Nada é
+// publicado para a sala; o resultado só aparece no fechamento
+func (m *MSLance) makeSealedBid(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	proposta := Proposta{UserID: bid.UserID, Valor: bid.Valor, Timestamp: m.clock.Now()}
+	for i := range leilao.Propostas {
+		if leilao.Propostas[i].UserID == bid.UserID {
+			leilao.Propostas[i] = proposta
+			log.Printf("Proposta revisada por %s (leilão %s)", bid.UserID, bid.LeilaoID)
+			return nil
+		}
+	}
 
+	leilao.Propostas = append(leilao.Propostas, proposta)
+	log.Printf("Proposta registrada por %s (leilão %s)", bid.UserID, bid.LeilaoID)
 	return nil
 }
 
-func (m *MSLance) GetHighestBid(auctionID string) (float64, error) {
-	auction, ok := m.leiloes[auctionID]
+// resolveSealed abre as propostas, define o vencedor e devolve o preço que ele
+// paga. Empates ficam com a proposta mais antiga
+func resolveSealed(leilao *LeilaoStatus) money.Money {
+	if len(leilao.Propostas) == 0 {
+		return money.Money{}
+	}
+
+	propostas := ordenarPropostas(leilao.Propostas)
+
+	leilao.Vencedor = propostas[0].UserID
+	leilao.MaiorLance = propostas[0].Valor
+
+	if leilao.Tipo != models.AuctionVickrey {
+		return leilao.MaiorLance
+	}
+
+	// no Vickrey o preço é o segundo maior lance, mas nunca abaixo do preço
+	// inicial ou da reserva
+	segundo := money.Max(leilao.StartingPrice, leilao.ReservePrice)
+	if len(propostas) > 1 {
+		segundo = money.Max(segundo, propostas[1].Valor)
+	}
+	return money.Min(leilao.MaiorLance, segundo)
+}
+
+// resolveProxy aplica o lance com limite sobre o estado do leilão, no estilo
+// do eBay: o líder com lance máximo só paga um incremento acima do segundo
+// colocado. Devolve true quando o novo lance perde para o máximo do líder.
+// Em empate vence quem chegou primeiro. O estado só muda quando não há erro
+func (m *MSLance) resolveProxy(leilao *LeilaoStatus, bid models.LanceRealizado, limite money.Money) (bool, error) {
+	minimo, err := leilao.ProximoLanceMinimo()
+	if err != nil {
+		return false, err
+	}
+
+	if leilao.Vencedor == "" || leilao.Vencedor == bid.UserID {
+		preco := minimo
+		if bid.ValorMaximo.IsZero() {
+			preco = bid.Valor
+		}
+		leilao.MaiorLance = preco
+		leilao.Vencedor = bid.UserID
+		leilao.MaximoVencedor = money.Max(limite, leilao.MaximoVencedor)
+		return false, nil
+	}
+
+	defensor := leilao.MaximoVencedor
+	if !limite.GreaterThan(defensor) {
+		resposta, err := leilao.maisIncremento(limite)
+		if err != nil {
+			return false, err
+		}
+		leilao.MaiorLance = money.Min(defensor, resposta)
+		return true, nil
+	}
+
+	preco, err := leilao.maisIncremento(defensor)
+	if err != nil {
+		return false, err
+	}
+	preco = money.Min(limite, preco)
+	if bid.ValorMaximo.IsZero() {
+		preco = bid.Valor
+	}
+	leilao.MaiorLance = money.Max(preco, minimo)
+	leilao.Vencedor = bid.UserID
+	leilao.MaximoVencedor = limite
+	return false, nil
+}
+
+// publishValidado anuncia o preço visível atual. O lance máximo do líder
+// nunca sai do mslance
+func (m *MSLance) publishValidado(leilao *LeilaoStatus) {
+	validado := models.LanceValidado{
+		LeilaoID:   leilao.ID,
+		UserID:     leilao.Vencedor,
+		Pseudonimo: leilao.pseudonimo(leilao.Vencedor),
+		Valor:      leilao.MaiorLance,
+		Timestamp:  m.clock.Now(),
+	}
+	body, _ := json.Marshal(validado)
+
+	log.Printf("✅ Lance validado: %s por %s (leilão %s)", leilao.MaiorLance, leilao.Vencedor, leilao.ID)
+	m.pub.Publish("lance.validado", body)
+
+	m.prorrogar(leilao, validado.Timestamp)
+}
+
+// prorrogar estende o fim do leilão no momento em que o lance é aceito. No
+// soft close, um lance nos últimos SoftCloseWindow segundos empurra o fim em
+// SoftCloseExtension; no leilão de centavos todo lance garante ao menos Timer
+// segundos até o fim. A decisão é tomada aqui, e não no msleilao, para que um
+// lance aceito logo antes do fim não perca a corrida para o timer de término:
+// o msleilao só reagenda o fim ao receber leilao.prorrogado
+func (m *MSLance) prorrogar(leilao *LeilaoStatus, agora time.Time) {
+	if !leilao.Ativo {
+		return
+	}
+
+	var fim time.Time
+	switch {
+	case leilao.Penny != nil:
+		fim = agora.Add(time.Duration(leilao.Penny.Timer) * time.Second)
+	case leilao.SoftCloseWindow > 0:
+		janela := time.Duration(leilao.SoftCloseWindow) * time.Second
+		if agora.Before(leilao.Fim.Add(-janela)) {
+			return
+		}
+		fim = leilao.Fim.Add(time.Duration(leilao.SoftCloseExtension) * time.Second)
+	default:
+		return
+	}
+	if !fim.After(leilao.Fim) {
+		return
+	}
+
+	leilao.Fim = fim
+	body, _ := json.Marshal(models.LeilaoProrrogado{ID: leilao.ID, DataFim: fim})
+	m.pub.Publish("leilao.prorrogado", body)
+	log.Printf("Leilão %s prorrogado até %s", leilao.ID, fim.Format(time.RFC3339))
+}
+
+func (m *MSLance) publishInvalidado(bid models.LanceRealizado, rej *Rejeicao) {
+	invalidado := models.LanceInvalidado{
+		LeilaoID: bid.LeilaoID,
+		UserID:   bid.UserID,
+		Valor:    bid.Valor,
+		Codigo:   rej.Codigo,
+		Motivo:   rej.Motivo,
+	}
+	body, _ := json.Marshal(invalidado)
+	m.pub.Publish("lance.invalidado", body)
+}
+
+// GetHighestBid lê o último snapshot publicado pela goroutine do leilão, sem
+// esperar pelos lances que estão na fila
+func (m *MSLance) GetHighestBid(auctionID string) (HighestBid, error) {
+	a, ok := m.actor(auctionID)
 	if !ok {
 		log.Printf("Leilão %s não encontrado", auctionID)
-		return 0, fmt.Errorf("leilão %s não encontrado", auctionID)
+		return HighestBid{}, fmt.Errorf("leilão %s não encontrado", auctionID)
+	}
+
+	return a.snapshot.Load().highest, nil
+}
+
+// highestBid monta o snapshot. Se o próximo lance não puder ser calculado ele
+// fica zerado, e o próprio lance será recusado pelas regras
+func (auction *LeilaoStatus) highestBid() HighestBid {
+	if auction.Tipo == models.AuctionReverse {
+		maximo, err := auction.ProximoLanceMaximo()
+		if err != nil {
+			log.Printf("Erro ao calcular o próximo lance do leilão %s: %v", auction.ID, err)
+		}
+		return HighestBid{
+			MaiorLance:         auction.MaiorLance,
+			Reverso:            true,
+			ProximoLanceMaximo: maximo,
+			Fim:                auction.Fim,
+		}
+	}
+
+	minimo, err := auction.ProximoLanceMinimo()
+	if err != nil {
+		log.Printf("Erro ao calcular o próximo lance do leilão %s: %v", auction.ID, err)
 	}
+	highest := HighestBid{
+		MaiorLance:         auction.MaiorLance,
+		ProximoLanceMinimo: minimo,
+		Fim:                auction.Fim,
+	}
+	if auction.CompraImediataDisponivel() {
+		highest.BuyNowPrice = auction.BuyNowPrice
+	}
+	return highest
+}
+
+func (m *MSLance) newLeilaoStatus(leilao models.LeilaoIniciado) *LeilaoStatus {
+	status := &LeilaoStatus{
+		ID:        leilao.ID,
+		Descricao: leilao.Descricao,
+		// o msleilao reemite leilao.iniciado de leilões perdidos durante um restart;
+		// se o fim também já passou o leilão não aceita mais lances
+		Ativo:         m.clock.Now().Before(leilao.DataFim),
+		Fim:           leilao.DataFim,
+		MaiorLance:    money.Money{},
+		Vencedor:      "",
+		ReservePrice:  leilao.ReservePrice,
+		StartingPrice: leilao.StartingPrice,
+		Increments:    leilao.Increments,
+		Tipo:          leilao.Tipo.Normalize(),
+		Quantidade:    max(leilao.Quantidade, 1),
+		CeilingPrice:  leilao.CeilingPrice,
+		Penny:         leilao.Penny,
+
+		SoftCloseWindow:    leilao.SoftCloseWindow,
+		SoftCloseExtension: leilao.SoftCloseExtension,
+
+		BuyNowPrice:     leilao.BuyNowPrice,
+		BuyNowThreshold: leilao.BuyNowThreshold,
 
-	return auction.MaiorLance, nil
+		SellerID:       leilao.SellerID,
+		MaxBidsPerUser: leilao.MaxBidsPerUser,
+	}
+	if leilao.Dutch != nil {
+		status.PrecoAtual = leilao.Dutch.StartPrice
+	}
+	return status
 }
 
+// ListenLeilaoIniciado cria o leilão. Como nos outros eventos de leilão, a
+// mensagem só é confirmada depois que a alteração foi gravada no StateStore:
+// se o mslance cair antes disso ela volta para a fila
 func (m *MSLance) ListenLeilaoIniciado() {
-	msgs, _ := m.ch.Consume("leilao_iniciado", "", true, false, false, false, nil)
+	msgs, _ := m.ch.Consume("leilao_iniciado", "", false, false, false, false, nil)
 	go func() {
 		for d := range msgs {
 			var leilao models.LeilaoIniciado
-			if err := json.Unmarshal(d.Body, &leilao); err == nil {
-				m.mu.Lock()
-				m.leiloes[leilao.ID] = &LeilaoStatus{
-					ID:         leilao.ID,
-					Descricao:  leilao.Descricao,
-					Ativo:      true,
-					MaiorLance: 0,
-					Vencedor:   "",
-				}
-				m.mu.Unlock()
+			if err := json.Unmarshal(d.Body, &leilao); err != nil {
+				d.Nack(false, false)
+				continue
+			}
+			// um leilão fora da moeda padrão não tem como receber lances, e
+			// voltar com ele para a fila só o faria chegar de novo
+			if err := leilao.CheckCurrency(); err != nil {
+				log.Printf("Leilão %s recusado: %v", leilao.ID, err)
+				d.Nack(false, false)
+				continue
+			}
+
+			// um leilao.iniciado repetido (reentrega, ou um leilão que a
+			// recuperação já trouxe do msleilao) não apaga os lances já recebidos
+			a, loaded := m.leiloes.LoadOrStore(leilao.ID, m.newActor(m.newLeilaoStatus(leilao)))
+			if !loaded {
+				// mensagem vazia só para a goroutine do leilão gravar o estado inicial
+				a.(*leilaoActor).call(func(*LeilaoStatus) {})
 				log.Printf("Leilão iniciado: %s (%s)", leilao.Descricao, leilao.ID)
 			}
+			d.Ack(false)
 		}
 	}()
 }
 
 func (m *MSLance) ListenLeilaoFinalizado() {
-	msgs, _ := m.ch.Consume("leilao_finalizado", "", true, false, false, false, nil)
+	msgs, _ := m.ch.Consume("leilao_finalizado", "", false, false, false, false, nil)
 	go func() {
 		for d := range msgs {
-			var finalizado struct {
-				ID string `json:"id"`
+			var finalizado models.LeilaoFinalizado
+			if err := json.Unmarshal(d.Body, &finalizado); err != nil {
+				d.Nack(false, false)
+				continue
 			}
-			if err := json.Unmarshal(d.Body, &finalizado); err == nil {
-				m.mu.Lock()
-				leilao, ok := m.leiloes[finalizado.ID]
-				if ok && leilao.Ativo {
-					leilao.Ativo = false
-					vencedor := models.LeilaoVencedor{
-						LeilaoID: leilao.ID,
-						UserID:   leilao.Vencedor,
-						Valor:    leilao.MaiorLance,
+
+			m.finalizar(finalizado)
+			d.Ack(false)
+		}
+	}()
+}
+
+// finalizar trata o leilao.finalizado do msleilao. O leilão pode estar
+// inativo sem ter sido encerrado, se o fim passou enquanto o mslance estava
+// fora do ar. Um leilão que o mslance prorrogou além do fim conhecido pelo
+// msleilao continua aberto: o leilao.prorrogado já publicado reabre o leilão
+// por lá, com o timer no fim novo
+func (m *MSLance) finalizar(finalizado models.LeilaoFinalizado) {
+	a, ok := m.actor(finalizado.ID)
+	if !ok {
+		return
+	}
+	a.call(func(leilao *LeilaoStatus) {
+		if leilao.Encerrado || leilao.Cancelado {
+			return
+		}
+		if !finalizado.DataFim.IsZero() && leilao.Fim.After(finalizado.DataFim) {
+			log.Printf("Leilão %s finalizado com o fim antigo, mas já prorrogado até %s", leilao.ID, leilao.Fim.Format(time.RFC3339))
+			return
+		}
+		m.closeLeilao(leilao)
+	})
+}
+
+// closeLeilao encerra o leilão e publica o resultado: leilao.vencedor, ou
+// leilao.reserva_nao_atingida quando o melhor lance não cobre a reserva.
+// Deve ser chamada na goroutine do leilão
+func (m *MSLance) closeLeilao(leilao *LeilaoStatus) {
+	leilao.Ativo = false
+	leilao.Encerrado = true
+
+	if leilao.Quantidade > 1 {
+		m.closeMultiUnit(leilao)
+		return
+	}
+
+	precoFinal := leilao.MaiorLance
+	if leilao.Tipo.Sealed() {
+		precoFinal = resolveSealed(leilao)
+	}
+
+	if leilao.Vencedor != "" && !leilao.reservaAtingida() {
+		reserva := models.LeilaoReservaNaoAtingida{
+			LeilaoID:   leilao.ID,
+			UserID:     leilao.Vencedor,
+			MaiorLance: leilao.MaiorLance,
+		}
+		body, _ := json.Marshal(reserva)
+		m.pub.Publish("leilao.reserva_nao_atingida", body)
+		log.Printf("Leilão %s finalizado sem atingir a reserva (%s)", leilao.ID, leilao.MaiorLance)
+		return
+	}
+
+	vencedor := models.LeilaoVencedor{
+		LeilaoID:   leilao.ID,
+		UserID:     leilao.Vencedor,
+		Pseudonimo: leilao.pseudonimo(leilao.Vencedor),
+		Valor:      leilao.MaiorLance,
+		PrecoFinal: precoFinal,
+	}
+	if leilao.Tipo == models.AuctionReverse {
+		vencedor.Direcao = models.DirecaoRepasse
+	}
+	body, _ := json.Marshal(vencedor)
+	m.pub.Publish("leilao.vencedor", body)
+	log.Printf("Leilão %s finalizado. Vencedor: %s (%s)", leilao.ID, leilao.Vencedor, precoFinal)
+}
+
+func (m *MSLance) ListenLeilaoCancelado() {
+	msgs, _ := m.ch.Consume("mslance_leilao_cancelado", "", false, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var cancelado models.LeilaoCancelado
+			if err := json.Unmarshal(d.Body, &cancelado); err != nil {
+				d.Nack(false, false)
+				continue
+			}
+
+			// um leilão cancelado antes de iniciar ainda não existe aqui, mas
+			// registramos para responder corretamente a lances atrasados
+			novo := m.newActor(&LeilaoStatus{ID: cancelado.ID, Descricao: cancelado.Descricao})
+			a, _ := m.leiloes.LoadOrStore(cancelado.ID, novo)
+			a.(*leilaoActor).call(func(leilao *LeilaoStatus) {
+				leilao.Ativo = false
+				leilao.Cancelado = true
+			})
+			log.Printf("Leilão cancelado: %s (%s)", cancelado.Descricao, cancelado.ID)
+			d.Ack(false)
+		}
+	}()
+}
+
+// ListenLeilaoAtualizado acompanha as edições feitas no msleilao. Um leilão
+// que ainda não começou não existe aqui e recebe as datas novas em
+// leilao.iniciado; para um em andamento só o fim e a descrição mudam
+func (m *MSLance) ListenLeilaoAtualizado() {
+	msgs, _ := m.ch.Consume("mslance_leilao_atualizado", "", false, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var atualizado models.LeilaoAtualizado
+			if err := json.Unmarshal(d.Body, &atualizado); err != nil {
+				d.Nack(false, false)
+				continue
+			}
+
+			if a, ok := m.actor(atualizado.ID); ok {
+				a.call(func(leilao *LeilaoStatus) {
+					leilao.Descricao = atualizado.Descricao
+					leilao.Fim = atualizado.DataFim
+				})
+			}
+			log.Printf("Leilão %s atualizado, termina em %s", atualizado.ID, atualizado.DataFim.Format(time.RFC3339))
+			d.Ack(false)
+		}
+	}()
+}
+
+func (m *MSLance) ListenLeilaoPrecoAtualizado() {
+	msgs, _ := m.ch.Consume("mslance_leilao_preco_atualizado", "", false, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var preco models.LeilaoPrecoAtualizado
+			if err := json.Unmarshal(d.Body, &preco); err != nil {
+				d.Nack(false, false)
+				continue
+			}
+
+			if a, ok := m.actor(preco.ID); ok {
+				a.call(func(leilao *LeilaoStatus) {
+					if leilao.Ativo {
+						leilao.PrecoAtual = preco.Preco
 					}
-					body, _ := json.Marshal(vencedor)
-					rabbitmq.PublishToExchange(m.ch, "leilao_events", "leilao.vencedor", body)
-					log.Printf("Leilão %s finalizado. Vencedor: %s (%.2f)", leilao.ID, leilao.Vencedor, leilao.MaiorLance)
-				}
-				m.mu.Unlock()
+				})
 			}
+			log.Printf("Leilão %s agora custa %s", preco.ID, preco.Preco)
+			d.Ack(false)
 		}
 	}()
 }
@@ -0,0 +1,555 @@
+package mslance
+
+import (
+	"auction-system/pkg/clock"
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type recordingPublisher struct {
+	mu  sync.Mutex
+	msg map[string][][]byte
+}
+
+func (p *recordingPublisher) Publish(key string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.msg == nil {
+		p.msg = make(map[string][][]byte)
+	}
+	p.msg[key] = append(p.msg[key], body)
+	return nil
+}
+
+// take decodifica em out (um ponteiro para slice) as publicações com a routing
+// key dada e as esquece
+func (p *recordingPublisher) take(t *testing.T, key string, out any) {
+	t.Helper()
+
+	p.mu.Lock()
+	bodies := p.msg[key]
+	delete(p.msg, key)
+	p.mu.Unlock()
+
+	raw := make([]json.RawMessage, len(bodies))
+	for i, b := range bodies {
+		raw[i] = b
+	}
+	data, _ := json.Marshal(raw)
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("decoding %s: %v", key, err)
+	}
+}
+
+type memHistory struct {
+	mu   sync.Mutex
+	recs []BidRecord
+}
+
+func (h *memHistory) Append(rec BidRecord) (BidRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rec.Seq = int64(len(h.recs) + 1)
+	h.recs = append(h.recs, rec)
+	return rec, nil
+}
+
+func (h *memHistory) List(auctionID string, offset, limit int) ([]BidRecord, int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var recs []BidRecord
+	for i := len(h.recs) - 1; i >= 0; i-- {
+		if h.recs[i].LeilaoID == auctionID {
+			recs = append(recs, h.recs[i])
+		}
+	}
+	total := len(recs)
+	recs = recs[min(offset, total):min(offset+limit, total)]
+	return recs, total, nil
+}
+
+type lanceHarness struct {
+	*MSLance
+	clk     *clock.Fake
+	pub     *recordingPublisher
+	history *memHistory
+}
+
+func newLanceHarness(t *testing.T) *lanceHarness {
+	t.Helper()
+
+	h := &lanceHarness{
+		clk:     clock.NewFake(t0),
+		pub:     &recordingPublisher{},
+		history: &memHistory{},
+	}
+	h.MSLance = newMSLance(h.pub, h.clk, h.history, discardStore{})
+	return h
+}
+
+// start cria um leilão ativo por uma hora. Sem incrementos na configuração o
+// incremento é de R$ 1,00
+func (h *lanceHarness) start(t *testing.T, ini models.LeilaoIniciado) string {
+	t.Helper()
+
+	ini.ID = models.NewAuctionID()
+	ini.DataInicio = h.clk.Now()
+	ini.DataFim = h.clk.Now().Add(time.Hour)
+	if len(ini.Increments) == 0 {
+		ini.Increments = models.IncrementTable{{Step: money.New(100)}}
+	}
+	h.leiloes.Store(ini.ID, h.newActor(h.newLeilaoStatus(ini)))
+	return ini.ID
+}
+
+func (h *lanceHarness) bid(auctionID, userID string, valor, maximo int64) error {
+	_, err := h.MakeBid(models.LanceRealizado{
+		LeilaoID:    auctionID,
+		UserID:      userID,
+		Valor:       money.New(valor),
+		ValorMaximo: money.New(maximo),
+	})
+	return err
+}
+
+func (h *lanceHarness) close(t *testing.T, auctionID string) []models.LeilaoVencedor {
+	t.Helper()
+
+	a, ok := h.actor(auctionID)
+	if !ok {
+		t.Fatalf("auction %s not found", auctionID)
+	}
+	a.call(func(leilao *LeilaoStatus) { h.closeLeilao(leilao) })
+
+	var vencedores []models.LeilaoVencedor
+	h.pub.take(t, "leilao.vencedor", &vencedores)
+	return vencedores
+}
+
+func (h *lanceHarness) highest(t *testing.T, auctionID string) HighestBid {
+	t.Helper()
+	hb, err := h.GetHighestBid(auctionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hb
+}
+
+func codigo(err error) models.CodigoRejeicao {
+	var rej *Rejeicao
+	if errors.As(err, &rej) {
+		return rej.Codigo
+	}
+	return ""
+}
+
+func TestProxyBidding(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+
+	// A deixa um máximo de R$ 50 e entra pelo preço inicial
+	if err := h.bid(id, "A", 1000, 5000); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+	if hb := h.highest(t, id); !hb.MaiorLance.Equal(money.New(1000)) {
+		t.Fatalf("price = %s after the first proxy bid, want the starting price", hb.MaiorLance)
+	}
+
+	// B dá R$ 20 e perde na hora para o máximo de A, que passa a pagar R$ 21
+	if err := h.bid(id, "B", 2000, 0); codigo(err) != models.RejeicaoSuperado {
+		t.Fatalf("B = %v, want outbid_by_proxy", err)
+	}
+	if hb := h.highest(t, id); !hb.MaiorLance.Equal(money.New(2100)) {
+		t.Fatalf("price = %s, want one increment above B", hb.MaiorLance)
+	}
+
+	// abaixo do próximo mínimo não chega a disputar com o máximo
+	if err := h.bid(id, "B", 2100, 0); codigo(err) != models.RejeicaoAbaixoMinimo {
+		t.Fatalf("B below minimum = %v, want below_minimum", err)
+	}
+
+	// C supera o máximo de A e paga um incremento acima dele
+	if err := h.bid(id, "C", 2200, 8000); err != nil {
+		t.Fatalf("C: %v", err)
+	}
+	if hb := h.highest(t, id); !hb.MaiorLance.Equal(money.New(5100)) {
+		t.Fatalf("price = %s, want one increment above A's maximum", hb.MaiorLance)
+	}
+	var superados []models.LanceSuperado
+	h.pub.take(t, "lance.superado", &superados)
+	if len(superados) != 1 || superados[0].UserID != "A" {
+		t.Fatalf("lance.superado = %+v, want one for A", superados)
+	}
+
+	// o líder sobe o próprio máximo sem mexer no preço, mas não pode baixá-lo
+	if err := h.bid(id, "C", 5200, 9000); err != nil {
+		t.Fatalf("C raising max: %v", err)
+	}
+	if err := h.bid(id, "C", 5200, 8500); codigo(err) != models.RejeicaoMaximoNaoAumentado {
+		t.Fatalf("C lowering max = %v, want max_not_raised", err)
+	}
+	if hb := h.highest(t, id); !hb.MaiorLance.Equal(money.New(5100)) {
+		t.Fatalf("price = %s after the leader raised the max, want it unchanged", hb.MaiorLance)
+	}
+
+	// A volta com máximo igual ao de C: o empate fica com quem chegou primeiro
+	if err := h.bid(id, "A", 5200, 9000); codigo(err) != models.RejeicaoSuperado {
+		t.Fatalf("A tying = %v, want outbid_by_proxy", err)
+	}
+
+	vencedores := h.close(t, id)
+	if len(vencedores) != 1 || vencedores[0].UserID != "C" || !vencedores[0].Preco().Equal(money.New(9000)) {
+		t.Fatalf("leilao.vencedor = %+v, want C paying the tied maximum", vencedores)
+	}
+}
+
+func TestSealedFirstPrice(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{Tipo: models.AuctionSealedFirstPrice, StartingPrice: money.New(1000)})
+
+	for _, b := range []struct {
+		user  string
+		valor int64
+	}{{"A", 3000}, {"B", 5000}, {"C", 4000}, {"A", 4500}} {
+		if err := h.bid(id, b.user, b.valor, 0); err != nil {
+			t.Fatalf("%s: %v", b.user, err)
+		}
+	}
+
+	// nada das propostas sai antes do fechamento
+	var validados []models.LanceValidado
+	h.pub.take(t, "lance.validado", &validados)
+	if len(validados) != 0 {
+		t.Fatalf("published %d lance.validado during a sealed auction", len(validados))
+	}
+	if _, _, err := h.BidHistory(id, 0, 10); !errors.Is(err, ErrHistorySealed) {
+		t.Fatalf("BidHistory during the auction = %v, want ErrHistorySealed", err)
+	}
+
+	vencedores := h.close(t, id)
+	if len(vencedores) != 1 || vencedores[0].UserID != "B" || !vencedores[0].Preco().Equal(money.New(5000)) {
+		t.Fatalf("leilao.vencedor = %+v, want B paying its own bid", vencedores)
+	}
+}
+
+func TestVickreyPrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		reserve int64
+		bids    map[string]int64
+		want    int64
+	}{
+		{"second highest bid", 0, map[string]int64{"A": 3000, "B": 5000, "C": 4000}, 4000},
+		{"reserve above second bid", 4500, map[string]int64{"A": 3000, "B": 5000, "C": 4000}, 4500},
+		{"single bidder pays starting price", 0, map[string]int64{"B": 5000}, 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newLanceHarness(t)
+			id := h.start(t, models.LeilaoIniciado{
+				Tipo:          models.AuctionVickrey,
+				StartingPrice: money.New(1000),
+				ReservePrice:  money.New(tt.reserve),
+			})
+			for user, valor := range tt.bids {
+				if err := h.bid(id, user, valor, 0); err != nil {
+					t.Fatalf("%s: %v", user, err)
+				}
+			}
+
+			vencedores := h.close(t, id)
+			if len(vencedores) != 1 || vencedores[0].UserID != "B" {
+				t.Fatalf("leilao.vencedor = %+v, want B", vencedores)
+			}
+			if got := vencedores[0].Preco(); !got.Equal(money.New(tt.want)) {
+				t.Errorf("price = %s, want %s", got, money.New(tt.want))
+			}
+			if !vencedores[0].Valor.Equal(money.New(5000)) {
+				t.Errorf("winning bid = %s, want B's own bid", vencedores[0].Valor)
+			}
+		})
+	}
+}
+
+// Um leilão com valores em outra moeda nunca deveria chegar aqui, mas se
+// chegar os lances são recusados em vez de derrubar a goroutine do leilão
+func TestMixedCurrencyRejectsBid(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{
+		StartingPrice: money.New(1000),
+		Increments:    models.IncrementTable{{Step: money.Money{Amount: 100, Currency: "USD"}}},
+	})
+
+	if err := h.bid(id, "A", 1000, 0); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+	if err := h.bid(id, "B", 5000, 0); codigo(err) != models.RejeicaoMoeda {
+		t.Fatalf("B = %v, want %s", err, models.RejeicaoMoeda)
+	}
+	if hb := h.highest(t, id); !hb.MaiorLance.Equal(money.New(1000)) || !hb.ProximoLanceMinimo.IsZero() {
+		t.Errorf("highest = %+v", hb)
+	}
+}
+
+// No leilão reverso o próximo lance é um teto: o preço inicial enquanto
+// ninguém deu lance, e zero quando o menor lance não pode mais ser coberto
+func TestReverseNextMaximumBid(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{
+		Tipo:         models.AuctionReverse,
+		CeilingPrice: money.New(5000),
+	})
+
+	if hb := h.highest(t, id); !hb.Reverso || !hb.ProximoLanceMaximo.Equal(money.New(5000)) {
+		t.Fatalf("highest = %+v, want ceiling as next maximum", hb)
+	}
+
+	if err := h.bid(id, "A", 3000, 0); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+	if hb := h.highest(t, id); !hb.ProximoLanceMaximo.Equal(money.New(2900)) {
+		t.Errorf("next maximum = %s, want %s", hb.ProximoLanceMaximo, money.New(2900))
+	}
+
+	if err := h.bid(id, "B", 100, 0); err != nil {
+		t.Fatalf("B: %v", err)
+	}
+	if hb := h.highest(t, id); !hb.Reverso || hb.ProximoLanceMaximo.IsPositive() {
+		t.Errorf("highest = %+v, want no next maximum", hb)
+	}
+}
+
+// O máximo do lance automático do líder não aparece no histórico, nem no
+// motivo da recusa de quem tentou baixá-lo
+func TestHistoryHidesProxyMaximum(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+
+	if err := h.bid(id, "A", 1000, 7300); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+	err := h.bid(id, "A", 1000, 5000)
+	if codigo(err) != models.RejeicaoMaximoNaoAumentado {
+		t.Fatalf("A lowering max = %v, want max_not_raised", err)
+	}
+	// quem deu o lance ainda recebe o próprio máximo no motivo
+	maximo := money.New(7300).String()
+	if !strings.Contains(err.Error(), maximo) {
+		t.Errorf("reason for the bidder = %q, want it to mention %s", err, maximo)
+	}
+
+	recs, _, err := h.BidHistory(id, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("history has %d records, want 2", len(recs))
+	}
+	for _, rec := range recs {
+		pub := rec.Anonimizado()
+		if strings.Contains(pub.Motivo, maximo) || strings.Contains(rec.Motivo, maximo) {
+			t.Errorf("history record %d exposes the proxy maximum: %q", rec.Seq, rec.Motivo)
+		}
+	}
+	if recs[0].Codigo != models.RejeicaoMaximoNaoAumentado {
+		t.Errorf("codigo = %q, want max_not_raised", recs[0].Codigo)
+	}
+}
+
+// TestSoftClose dá lances fora da janela final, dentro dela e no fim exato,
+// com o relógio do mslance
+func TestSoftClose(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{
+		StartingPrice:      money.New(1000),
+		SoftCloseWindow:    60,
+		SoftCloseExtension: 120,
+	})
+	fim := t0.Add(time.Hour)
+
+	h.clk.Advance(time.Hour - 61*time.Second)
+	if err := h.bid(id, "A", 1000, 0); err != nil {
+		t.Fatalf("A outside the window: %v", err)
+	}
+	var prorrogados []models.LeilaoProrrogado
+	h.pub.take(t, "leilao.prorrogado", &prorrogados)
+	if len(prorrogados) != 0 || !h.highest(t, id).Fim.Equal(fim) {
+		t.Fatalf("bid outside the window moved the end: %+v", prorrogados)
+	}
+
+	h.clk.Advance(31 * time.Second)
+	if err := h.bid(id, "B", 1100, 0); err != nil {
+		t.Fatalf("B inside the window: %v", err)
+	}
+	fim = fim.Add(2 * time.Minute)
+	h.pub.take(t, "leilao.prorrogado", &prorrogados)
+	if len(prorrogados) != 1 || !prorrogados[0].DataFim.Equal(fim) || !h.highest(t, id).Fim.Equal(fim) {
+		t.Fatalf("leilao.prorrogado = %+v, want the end moved to %s", prorrogados, fim)
+	}
+
+	h.clk.Set(fim)
+	if err := h.bid(id, "A", 5000, 0); codigo(err) != models.RejeicaoLeilaoInativo {
+		t.Fatalf("bid at the end = %v, want auction_not_active", err)
+	}
+	h.pub.take(t, "leilao.prorrogado", &prorrogados)
+	if len(prorrogados) != 0 || !h.highest(t, id).Fim.Equal(fim) {
+		t.Fatalf("bid at the end moved it: %+v", prorrogados)
+	}
+}
+
+// O timer do msleilao pode encerrar o leilão pelo fim antigo antes de saber
+// da prorrogação; o mslance só fecha com o fim que ele mesmo conhece
+func TestFinalizadoAfterExtension(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{
+		StartingPrice:      money.New(1000),
+		SoftCloseWindow:    60,
+		SoftCloseExtension: 120,
+	})
+	antigo := t0.Add(time.Hour)
+
+	h.clk.Set(antigo.Add(-time.Second))
+	if err := h.bid(id, "A", 1000, 0); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+
+	h.clk.Set(antigo)
+	h.finalizar(models.LeilaoFinalizado{ID: id, DataFim: antigo})
+	var vencedores []models.LeilaoVencedor
+	h.pub.take(t, "leilao.vencedor", &vencedores)
+	if len(vencedores) != 0 {
+		t.Fatalf("leilao.vencedor = %+v at the old end, want none", vencedores)
+	}
+	if err := h.bid(id, "B", 1100, 0); err != nil {
+		t.Fatalf("B after the old end: %v", err)
+	}
+
+	novo := h.highest(t, id).Fim
+	h.clk.Set(novo)
+	h.finalizar(models.LeilaoFinalizado{ID: id, DataFim: novo})
+	h.pub.take(t, "leilao.vencedor", &vencedores)
+	if len(vencedores) != 1 || vencedores[0].UserID != "B" {
+		t.Fatalf("leilao.vencedor = %+v at the new end, want B", vencedores)
+	}
+}
+
+func TestReserveOutcomeEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		bids      map[string]int64
+		vencedor  string
+		naoAtinge bool
+	}{
+		{"reserve met", map[string]int64{"A": 2500}, "A", false},
+		{"reserve missed", map[string]int64{"A": 1500}, "", true},
+		{"no bids", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newLanceHarness(t)
+			id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000), ReservePrice: money.New(2000)})
+			for user, valor := range tt.bids {
+				if err := h.bid(id, user, valor, 0); err != nil {
+					t.Fatalf("%s: %v", user, err)
+				}
+			}
+
+			vencedores := h.close(t, id)
+			var reservas []models.LeilaoReservaNaoAtingida
+			h.pub.take(t, "leilao.reserva_nao_atingida", &reservas)
+
+			if tt.naoAtinge {
+				if len(vencedores) != 0 || len(reservas) != 1 || reservas[0].UserID != "A" || !reservas[0].MaiorLance.Equal(money.New(1500)) {
+					t.Fatalf("leilao.vencedor = %+v, leilao.reserva_nao_atingida = %+v, want only the missed reserve for A at 15.00", vencedores, reservas)
+				}
+				return
+			}
+			if len(reservas) != 0 || len(vencedores) != 1 || vencedores[0].UserID != tt.vencedor {
+				t.Fatalf("leilao.vencedor = %+v, leilao.reserva_nao_atingida = %+v, want winner %q", vencedores, reservas, tt.vencedor)
+			}
+		})
+	}
+}
+
+func TestOutbidNotification(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+
+	etapas := []struct {
+		user          string
+		valor, maximo int64
+		codigo        models.CodigoRejeicao
+		superado      string
+	}{
+		{"A", 1000, 0, "", ""},
+		{"B", 1100, 0, "", "A"},
+		{"A", 1200, 5000, "", "B"},
+		// B perde para o máximo de A: A continua líder e não é avisado
+		{"B", 1300, 0, models.RejeicaoSuperado, ""},
+		// o líder subindo o próprio máximo também não avisa ninguém
+		{"A", 0, 6000, "", ""},
+	}
+	for i, e := range etapas {
+		if err := h.bid(id, e.user, e.valor, e.maximo); codigo(err) != e.codigo {
+			t.Fatalf("bid %d by %s = %v, want %q", i, e.user, err, e.codigo)
+		}
+		var superados []models.LanceSuperado
+		h.pub.take(t, "lance.superado", &superados)
+		if e.superado == "" {
+			if len(superados) != 0 {
+				t.Fatalf("bid %d by %s: lance.superado = %+v, want none", i, e.user, superados)
+			}
+			continue
+		}
+		if len(superados) != 1 || superados[0].UserID != e.superado || superados[0].LeilaoID != id {
+			t.Fatalf("bid %d by %s: lance.superado = %+v, want one for %s", i, e.user, superados, e.superado)
+		}
+	}
+}
+
+func TestNextMinimumBid(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(98_00), Increments: models.DefaultIncrements})
+	semInicial := h.start(t, models.LeilaoIniciado{Increments: models.DefaultIncrements})
+
+	if got := h.highest(t, semInicial).ProximoLanceMinimo; !got.Equal(money.New(1)) {
+		t.Errorf("next minimum without a starting price = %s, want 0.01", got)
+	}
+
+	// cada lance vem exatamente no mínimo; um centavo abaixo é recusado
+	etapas := []struct {
+		minimo  int64
+		proximo int64
+	}{
+		{98_00, 99_00},   // faixa de R$ 1 abaixo de R$ 100
+		{99_00, 100_00},  // o lance cai na faixa de baixo
+		{100_00, 105_00}, // no limite da faixa o incremento já é R$ 5
+		{105_00, 110_00},
+	}
+	for i, e := range etapas {
+		if got := h.highest(t, id).ProximoLanceMinimo; !got.Equal(money.New(e.minimo)) {
+			t.Fatalf("step %d: next minimum = %s, want %s", i, got, money.New(e.minimo))
+		}
+		user := fmt.Sprintf("U%d", i)
+		if err := h.bid(id, user, e.minimo-1, 0); codigo(err) != models.RejeicaoAbaixoMinimo {
+			t.Fatalf("step %d: bid a cent below the minimum = %v, want below_minimum", i, err)
+		}
+		if err := h.bid(id, user, e.minimo, 0); err != nil {
+			t.Fatalf("step %d: bid at the minimum: %v", i, err)
+		}
+		if got := h.highest(t, id).ProximoLanceMinimo; !got.Equal(money.New(e.proximo)) {
+			t.Fatalf("step %d: next minimum after %s = %s, want %s", i, money.New(e.minimo), got, money.New(e.proximo))
+		}
+	}
+}
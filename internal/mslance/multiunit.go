@@ -0,0 +1,204 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"encoding/json"
+	"log"
+	"sort"
+)
+
+// alocacao é a fatia de unidades que uma proposta leva no fechamento
+type alocacao struct {
+	Proposta
+	Unidades int
+}
+
+// ordenarPropostas ordena do maior para o menor lance; empates ficam com a
+// proposta mais antiga
+func ordenarPropostas(propostas []Proposta) []Proposta {
+	ordenadas := make([]Proposta, len(propostas))
+	copy(ordenadas, propostas)
+	sort.SliceStable(ordenadas, func(i, j int) bool {
+		if ordenadas[i].Valor.Equal(ordenadas[j].Valor) {
+			return ordenadas[i].Timestamp.Before(ordenadas[j].Timestamp)
+		}
+		return ordenadas[i].Valor.GreaterThan(ordenadas[j].Valor)
+	})
+	return ordenadas
+}
+
+// alocar distribui as unidades entre as propostas, da maior para a menor. O
+// último vencedor pode levar menos unidades do que pediu. Devolve também a
+// primeira proposta que ficou sem nenhuma unidade, usada no preço Vickrey
+func alocar(propostas []Proposta, unidades int) ([]alocacao, *Proposta) {
+	var vencedores []alocacao
+	for _, p := range ordenarPropostas(propostas) {
+		if unidades == 0 {
+			return vencedores, &p
+		}
+		qtd := min(p.quantidade(), unidades)
+		vencedores = append(vencedores, alocacao{Proposta: p, Unidades: qtd})
+		unidades -= qtd
+	}
+	return vencedores, nil
+}
+
+func (p Proposta) quantidade() int {
+	if p.Quantidade < 1 {
+		return 1
+	}
+	return p.Quantidade
+}
+
+// propostaDe devolve a proposta atual do usuário, se ele já tiver uma
+func (l *LeilaoStatus) propostaDe(userID string) (Proposta, bool) {
+	for _, p := range l.Propostas {
+		if p.UserID == userID {
+			return p, true
+		}
+	}
+	return Proposta{}, false
+}
+
+// minimoMultiUnidade é o menor lance que ainda leva alguma unidade. Enquanto
+// a demanda dos outros participantes não esgota o lote basta o preço inicial;
+// depois é preciso superar o menor lance vencedor em um incremento. A conta
+// deixa de fora a proposta de exceto, que será substituída; por isso a regra
+// MinimumBid também impede que uma revisão baixe o valor
+func (l *LeilaoStatus) minimoMultiUnidade(exceto string, quantidade int) (money.Money, error) {
+	inicial := money.Max(l.StartingPrice, lanceMinimoAbsoluto)
+	if l.Tipo.Sealed() {
+		return inicial, nil
+	}
+
+	var outras []Proposta
+	demanda := quantidade
+	for _, p := range l.Propostas {
+		if p.UserID != exceto {
+			outras = append(outras, p)
+			demanda += p.quantidade()
+		}
+	}
+	if demanda <= l.Quantidade {
+		return inicial, nil
+	}
+
+	vencedores, _ := alocar(outras, l.Quantidade)
+	menor := vencedores[len(vencedores)-1].Valor
+	return l.maisIncremento(menor)
+}
+
+// makeMultiUnitBid registra ou revisa a proposta do usuário em um leilão de
+// várias unidades. Nos modos selados nada é publicado para a sala
+func (m *MSLance) makeMultiUnitBid(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	quantidade := max(bid.Quantidade, 1)
+
+	antes := contemplados(leilao)
+
+	proposta := Proposta{UserID: bid.UserID, Valor: bid.Valor, Quantidade: quantidade, Timestamp: m.clock.Now()}
+	revisada := false
+	for i := range leilao.Propostas {
+		if leilao.Propostas[i].UserID == bid.UserID {
+			leilao.Propostas[i] = proposta
+			revisada = true
+		}
+	}
+	if !revisada {
+		leilao.Propostas = append(leilao.Propostas, proposta)
+	}
+
+	if leilao.Tipo.Sealed() {
+		log.Printf("Proposta de %d unidade(s) registrada por %s (leilão %s)", quantidade, bid.UserID, bid.LeilaoID)
+		return nil
+	}
+
+	leilao.MaiorLance = money.Max(leilao.MaiorLance, bid.Valor)
+
+	validado := models.LanceValidado{
+		LeilaoID:   bid.LeilaoID,
+		UserID:     bid.UserID,
+		Pseudonimo: leilao.pseudonimo(bid.UserID),
+		Valor:      bid.Valor,
+		Quantidade: quantidade,
+		Timestamp:  proposta.Timestamp,
+	}
+	body, _ := json.Marshal(validado)
+
+	log.Printf("✅ Lance validado: %d x %s por %s (leilão %s)", quantidade, bid.Valor, bid.UserID, bid.LeilaoID)
+	m.pub.Publish("lance.validado", body)
+	m.prorrogar(leilao, proposta.Timestamp)
+
+	// aqui não há um líder só: superado é quem ficou sem nenhuma unidade
+	depois := contemplados(leilao)
+	for userID := range antes {
+		if !depois[userID] {
+			m.publishSuperado(leilao, userID, bid.Valor)
+		}
+	}
+
+	return nil
+}
+
+// closeMultiUnit aloca o lote e publica um leilao.vencedor por participante
+// contemplado, todos com o mesmo preço unitário: o menor lance vencedor, ou no
+// Vickrey o maior lance que ficou de fora. Só entram propostas que cobrem a
+// reserva. Deve ser chamada na goroutine do leilão
+func (m *MSLance) closeMultiUnit(leilao *LeilaoStatus) {
+	var elegiveis []Proposta
+	for _, p := range leilao.Propostas {
+		if !p.Valor.LessThan(leilao.ReservePrice) {
+			elegiveis = append(elegiveis, p)
+		}
+	}
+
+	if len(elegiveis) == 0 {
+		if len(leilao.Propostas) > 0 {
+			melhor := ordenarPropostas(leilao.Propostas)[0]
+			reserva := models.LeilaoReservaNaoAtingida{
+				LeilaoID:   leilao.ID,
+				UserID:     melhor.UserID,
+				MaiorLance: melhor.Valor,
+			}
+			body, _ := json.Marshal(reserva)
+			m.pub.Publish("leilao.reserva_nao_atingida", body)
+			log.Printf("Leilão %s finalizado sem atingir a reserva (%s)", leilao.ID, melhor.Valor)
+			return
+		}
+
+		vencedor := models.LeilaoVencedor{LeilaoID: leilao.ID}
+		body, _ := json.Marshal(vencedor)
+		m.pub.Publish("leilao.vencedor", body)
+		log.Printf("Leilão %s finalizado sem lances", leilao.ID)
+		return
+	}
+
+	vencedores, primeiroPerdedor := alocar(elegiveis, leilao.Quantidade)
+
+	preco := vencedores[len(vencedores)-1].Valor
+	if leilao.Tipo == models.AuctionVickrey {
+		segundo := money.Max(leilao.StartingPrice, leilao.ReservePrice)
+		if primeiroPerdedor != nil {
+			segundo = money.Max(segundo, primeiroPerdedor.Valor)
+		}
+		preco = money.Min(preco, segundo)
+	}
+
+	leilao.Vencedor = vencedores[0].UserID
+	leilao.MaiorLance = vencedores[0].Valor
+
+	for _, v := range vencedores {
+		vencedor := models.LeilaoVencedor{
+			LeilaoID:   leilao.ID,
+			UserID:     v.UserID,
+			Pseudonimo: leilao.pseudonimo(v.UserID),
+			Valor:      v.Valor,
+			PrecoFinal: preco,
+			Quantidade: v.Unidades,
+			Vencedores: len(vencedores),
+		}
+		body, _ := json.Marshal(vencedor)
+		m.pub.Publish("leilao.vencedor", body)
+		log.Printf("Leilão %s: %s leva %d unidade(s) a %s", leilao.ID, v.UserID, v.Unidades, preco)
+	}
+}
@@ -0,0 +1,137 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"testing"
+)
+
+func (h *lanceHarness) bidUnits(auctionID, userID string, quantidade int, valor int64) error {
+	_, err := h.MakeBid(models.LanceRealizado{
+		LeilaoID:   auctionID,
+		UserID:     userID,
+		Valor:      money.New(valor),
+		Quantidade: quantidade,
+	})
+	return err
+}
+
+func unidades(vencedores []models.LeilaoVencedor) map[string]int {
+	got := make(map[string]int)
+	for _, v := range vencedores {
+		got[v.UserID] = v.Quantidade
+	}
+	return got
+}
+
+func TestMultiUnitUniformPrice(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{Quantidade: 3, StartingPrice: money.New(1000)})
+
+	if err := h.bidUnits(id, "C", 1, 3000); err != nil {
+		t.Fatalf("C: %v", err)
+	}
+	if err := h.bidUnits(id, "B", 2, 4000); err != nil {
+		t.Fatalf("B: %v", err)
+	}
+
+	// com o lote esgotado é preciso superar o menor lance vencedor (C, R$ 30)
+	if err := h.bidUnits(id, "A", 1, 3000); codigo(err) != models.RejeicaoAbaixoMinimo {
+		t.Fatalf("A at the lowest winning bid = %v, want below_minimum", err)
+	}
+	if err := h.bidUnits(id, "A", 4, 9000); codigo(err) != models.RejeicaoQuantidade {
+		t.Fatalf("A asking for more than the lot = %v, want quantity_exceeded", err)
+	}
+	if err := h.bidUnits(id, "A", 1, 5000); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+
+	var superados []models.LanceSuperado
+	h.pub.take(t, "lance.superado", &superados)
+	if len(superados) != 1 || superados[0].UserID != "C" {
+		t.Fatalf("lance.superado = %+v, want one for C", superados)
+	}
+
+	vencedores := h.close(t, id)
+	if got := unidades(vencedores); len(got) != 2 || got["A"] != 1 || got["B"] != 2 {
+		t.Fatalf("units = %v, want A:1 B:2", got)
+	}
+	for _, v := range vencedores {
+		if !v.Preco().Equal(money.New(4000)) || v.Vencedores != 2 {
+			t.Errorf("%s pays %s with %d winners, want the lowest winning bid and 2 winners", v.UserID, v.Preco(), v.Vencedores)
+		}
+	}
+}
+
+func TestMultiUnitPartialFill(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{Quantidade: 3, Tipo: models.AuctionSealedFirstPrice})
+
+	if err := h.bidUnits(id, "A", 2, 5000); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.bidUnits(id, "B", 2, 4000); err != nil {
+		t.Fatal(err)
+	}
+
+	vencedores := h.close(t, id)
+	if got := unidades(vencedores); got["A"] != 2 || got["B"] != 1 {
+		t.Fatalf("units = %v, want A:2 and B taking the one left", got)
+	}
+	for _, v := range vencedores {
+		if !v.Preco().Equal(money.New(4000)) {
+			t.Errorf("%s pays %s, want the lowest winning bid", v.UserID, v.Preco())
+		}
+	}
+}
+
+func TestMultiUnitVickreyPrice(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{Quantidade: 2, Tipo: models.AuctionVickrey, StartingPrice: money.New(1000)})
+
+	for user, valor := range map[string]int64{"A": 5000, "B": 4000, "C": 3000} {
+		if err := h.bidUnits(id, user, 1, valor); err != nil {
+			t.Fatalf("%s: %v", user, err)
+		}
+	}
+
+	vencedores := h.close(t, id)
+	if got := unidades(vencedores); len(got) != 2 || got["A"] != 1 || got["B"] != 1 {
+		t.Fatalf("units = %v, want A:1 B:1", got)
+	}
+	for _, v := range vencedores {
+		if !v.Preco().Equal(money.New(3000)) {
+			t.Errorf("%s pays %s, want the highest losing bid", v.UserID, v.Preco())
+		}
+	}
+}
+
+// TestMultiUnitRevisionCannotLower impede que quem já leva unidades afaste os
+// concorrentes com um lance alto e depois volte ao preço inicial
+func TestMultiUnitRevisionCannotLower(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{Quantidade: 2, StartingPrice: money.New(1000)})
+
+	if err := h.bidUnits(id, "A", 1, 9000); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+	if err := h.bidUnits(id, "B", 1, 3000); err != nil {
+		t.Fatalf("B: %v", err)
+	}
+	if err := h.bidUnits(id, "A", 1, 1000); codigo(err) != models.RejeicaoAbaixoMinimo {
+		t.Fatalf("A lowering to the starting price = %v, want below_minimum", err)
+	}
+	if err := h.bidUnits(id, "A", 2, 9000); err != nil {
+		t.Fatalf("A asking for more units at the same price: %v", err)
+	}
+
+	vencedores := h.close(t, id)
+	if got := unidades(vencedores); got["A"] != 2 {
+		t.Fatalf("units = %v, want A:2", got)
+	}
+	for _, v := range vencedores {
+		if !v.Preco().Equal(money.New(9000)) {
+			t.Errorf("%s pays %s, want A's unchanged bid", v.UserID, v.Preco())
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"encoding/json"
+	"log"
+)
+
+// publishSuperado avisa o participante que perdeu a liderança. O aviso é
+// privado: o gateway só o entrega para o próprio usuário
+func (m *MSLance) publishSuperado(leilao *LeilaoStatus, userID string, valor money.Money) {
+	superado := models.LanceSuperado{
+		LeilaoID:  leilao.ID,
+		UserID:    userID,
+		Valor:     valor,
+		Timestamp: m.clock.Now(),
+	}
+	body, _ := json.Marshal(superado)
+
+	log.Printf("Lance de %s superado (leilão %s)", userID, leilao.ID)
+	m.pub.Publish("lance.superado", body)
+}
+
+// notifyLiderTrocado publica lance.superado para o líder anterior quando o
+// lance tirou a liderança dele. Deve ser chamada na goroutine do leilão
+func (m *MSLance) notifyLiderTrocado(leilao *LeilaoStatus, anterior string) {
+	if anterior == "" || anterior == leilao.Vencedor {
+		return
+	}
+	m.publishSuperado(leilao, anterior, leilao.MaiorLance)
+}
+
+// contemplados são os participantes que hoje levariam alguma unidade de um
+// leilão de várias unidades
+func contemplados(leilao *LeilaoStatus) map[string]bool {
+	vencedores, _ := alocar(leilao.Propostas, leilao.Quantidade)
+	users := make(map[string]bool, len(vencedores))
+	for _, v := range vencedores {
+		users[v.UserID] = true
+	}
+	return users
+}
@@ -0,0 +1,83 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"encoding/json"
+	"log"
+)
+
+// makePennyBid cobra um crédito e sobe o preço do leilão de centavos no
+// incremento fixo. O valor enviado no lance é ignorado: todo lance vale o
+// próximo preço. Os créditos são conferidos aqui e não numa regra porque a
+// conferência e o débito precisam acontecer juntos
+func (m *MSLance) makePennyBid(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	preco, err := leilao.ProximoLanceMinimo()
+	if err != nil {
+		return rejeitarMoeda(err)
+	}
+
+	m.creditosMu.Lock()
+	saldo := m.creditos[bid.UserID]
+	if saldo > 0 {
+		m.creditos[bid.UserID]--
+		m.saveCreditos(bid.UserID, saldo-1, "")
+	}
+	m.creditosMu.Unlock()
+
+	if saldo < 1 {
+		return rejeitar(models.RejeicaoSemCreditos, "Créditos insuficientes")
+	}
+
+	leilao.MaiorLance = preco
+	leilao.Vencedor = bid.UserID
+
+	m.publishValidado(leilao)
+
+	return nil
+}
+
+// Creditos devolve o saldo de créditos do usuário para o leilão de centavos
+func (m *MSLance) Creditos(userID string) int {
+	m.creditosMu.Lock()
+	defer m.creditosMu.Unlock()
+
+	return m.creditos[userID]
+}
+
+// saveCreditos grava o saldo do usuário. Deve ser chamada com m.creditosMu
+// travado, para que os saldos cheguem ao arquivo na mesma ordem das alterações
+func (m *MSLance) saveCreditos(userID string, saldo int, transactionID string) {
+	if err := m.store.SaveCreditos(userID, saldo, transactionID); err != nil {
+		log.Printf("Erro ao gravar créditos de %s: %v", userID, err)
+	}
+}
+
+func (m *MSLance) ListenCreditosAdquiridos() {
+	msgs, _ := m.ch.Consume("mslance_creditos_adquiridos", "", false, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var compra models.CreditosAdquiridos
+			if err := json.Unmarshal(d.Body, &compra); err != nil {
+				d.Nack(false, false)
+				continue
+			}
+
+			m.creditosMu.Lock()
+			// uma compra reentregue depois de um restart não soma de novo
+			if compra.TransactionID != "" && m.compras[compra.TransactionID] {
+				m.creditosMu.Unlock()
+				d.Ack(false)
+				continue
+			}
+			m.creditos[compra.UserID] += compra.Creditos
+			saldo := m.creditos[compra.UserID]
+			if compra.TransactionID != "" {
+				m.compras[compra.TransactionID] = true
+			}
+			m.saveCreditos(compra.UserID, saldo, compra.TransactionID)
+			m.creditosMu.Unlock()
+			log.Printf("%d créditos adicionados para %s (saldo %d)", compra.Creditos, compra.UserID, saldo)
+			d.Ack(false)
+		}
+	}()
+}
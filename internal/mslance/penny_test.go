@@ -0,0 +1,105 @@
+package mslance
+
+import (
+	"auction-system/pkg/clock"
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestPennyBidDebitsCredits confere que cada lance aceito gasta um crédito,
+// que os recusados não gastam nada e que o saldo chega ao StateStore
+func TestPennyBidDebitsCredits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	store, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &lanceHarness{clk: clock.NewFake(t0), pub: &recordingPublisher{}, history: &memHistory{}}
+	h.MSLance = newMSLance(h.pub, h.clk, h.history, store)
+	id := h.start(t, models.LeilaoIniciado{
+		Tipo:          models.AuctionPenny,
+		StartingPrice: money.New(0),
+		Penny:         &models.PennyParams{Increment: money.New(1), Timer: 10},
+	})
+	h.creditos["A"] = 2
+	h.creditos["B"] = 1
+
+	lances := []struct {
+		user string
+		want models.CodigoRejeicao
+	}{
+		{"A", ""},
+		{"A", models.RejeicaoJaLider},
+		{"B", ""},
+		{"B", models.RejeicaoJaLider},
+		{"A", ""},
+		{"B", models.RejeicaoSemCreditos},
+	}
+	for i, l := range lances {
+		// o valor enviado é ignorado; todo lance vale o próximo preço
+		if err := h.bid(id, l.user, 999, 0); codigo(err) != l.want {
+			t.Fatalf("bid %d by %s = %v, want %q", i, l.user, err, l.want)
+		}
+	}
+
+	if v := h.close(t, id); len(v) != 1 || v[0].UserID != "A" || !v[0].Valor.Equal(money.New(3)) {
+		t.Errorf("leilao.vencedor = %+v, want A at 0.03", v)
+	}
+	for _, user := range []string{"A", "B"} {
+		if saldo := h.Creditos(user); saldo != 0 {
+			t.Errorf("Creditos(%s) = %d, want 0", user, saldo)
+		}
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	estado, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estado.Creditos["A"] != 0 || estado.Creditos["B"] != 0 {
+		t.Errorf("stored balances = %v, want both debited to 0", estado.Creditos)
+	}
+}
+
+// TestPennyBidKeepsTimer confere que o lance garante ao menos Timer segundos
+// até o fim, sem nunca adiantá-lo
+func TestPennyBidKeepsTimer(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{
+		Tipo:  models.AuctionPenny,
+		Penny: &models.PennyParams{Increment: money.New(1), Timer: 10},
+	})
+	h.creditos["A"] = 1
+	h.creditos["B"] = 1
+	fim := t0.Add(time.Hour)
+
+	h.clk.Advance(30 * time.Second)
+	if err := h.bid(id, "A", 0, 0); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+	if got := h.highest(t, id).Fim; !got.Equal(fim) {
+		t.Fatalf("end after a bid with time to spare = %s, want unchanged", got.Sub(t0))
+	}
+
+	h.clk.Set(fim.Add(-3 * time.Second))
+	if err := h.bid(id, "B", 0, 0); err != nil {
+		t.Fatalf("B: %v", err)
+	}
+	want := fim.Add(7 * time.Second)
+	var prorrogados []models.LeilaoProrrogado
+	h.pub.take(t, "leilao.prorrogado", &prorrogados)
+	if len(prorrogados) != 1 || !prorrogados[0].DataFim.Equal(want) {
+		t.Fatalf("leilao.prorrogado = %+v, want the end 10s after B's bid", prorrogados)
+	}
+}
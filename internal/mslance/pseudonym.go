@@ -0,0 +1,29 @@
+package mslance
+
+import "fmt"
+
+// pseudonimo devolve o apelido público do usuário neste leilão ("Bidder 3"),
+// criando um na primeira vez que ele aparece. Os números seguem a ordem de
+// chegada dos participantes e ficam gravados com o estado, então não mudam
+// num restart. Deve ser chamada na goroutine do leilão
+func (l *LeilaoStatus) pseudonimo(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if p, ok := l.Pseudonimos[userID]; ok {
+		return p
+	}
+	if l.Pseudonimos == nil {
+		l.Pseudonimos = make(map[string]string)
+	}
+	p := fmt.Sprintf("Bidder %d", len(l.Pseudonimos)+1)
+	l.Pseudonimos[userID] = p
+	return p
+}
+
+// Anonimizado devolve o registro como o público o vê: sem o ID do usuário,
+// só com o pseudônimo
+func (r BidRecord) Anonimizado() BidRecord {
+	r.UserID = ""
+	return r
+}
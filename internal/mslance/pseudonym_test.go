@@ -0,0 +1,59 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"testing"
+)
+
+func TestPseudonimo(t *testing.T) {
+	var l LeilaoStatus
+	for _, c := range []struct{ user, want string }{
+		{"A", "Bidder 1"},
+		{"B", "Bidder 2"},
+		{"A", "Bidder 1"},
+		{"", ""},
+		{"C", "Bidder 3"},
+	} {
+		if got := l.pseudonimo(c.user); got != c.want {
+			t.Errorf("pseudonimo(%q) = %q, want %q", c.user, got, c.want)
+		}
+	}
+}
+
+func TestPublicEventsUsePseudonym(t *testing.T) {
+	h := newLanceHarness(t)
+	id := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+	outro := h.start(t, models.LeilaoIniciado{StartingPrice: money.New(1000)})
+
+	for _, lance := range []struct {
+		leilao, user string
+		valor        int64
+	}{{id, "A", 1000}, {id, "B", 1100}, {outro, "B", 1000}} {
+		if err := h.bid(lance.leilao, lance.user, lance.valor, 0); err != nil {
+			t.Fatalf("%s: %v", lance.user, err)
+		}
+	}
+
+	var validados []models.LanceValidado
+	h.pub.take(t, "lance.validado", &validados)
+	want := []string{"Bidder 1", "Bidder 2", "Bidder 1"}
+	if len(validados) != len(want) {
+		t.Fatalf("published %d lance.validado, want %d", len(validados), len(want))
+	}
+	for i, v := range validados {
+		if v.Pseudonimo != want[i] {
+			t.Errorf("lance.validado %d pseudonimo = %q, want %q (numbered per auction)", i, v.Pseudonimo, want[i])
+		}
+	}
+
+	registros, _, err := h.history.List(id, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range registros {
+		if a := r.Anonimizado(); a.UserID != "" || a.Pseudonimo == "" {
+			t.Errorf("Anonimizado() = %+v, want only the pseudonym", a)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package mslance
+
+import (
+	"auction-system/pkg/rabbitmq"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher publica os eventos do mslance na exchange leilao_events. É chamado
+// das goroutines de vários leilões ao mesmo tempo
+type Publisher interface {
+	Publish(routingKey string, body []byte) error
+}
+
+// amqpPublisher publica pelo canal do RabbitMQ, que já serializa as
+// publicações internamente
+type amqpPublisher struct {
+	ch *amqp.Channel
+}
+
+func (p amqpPublisher) Publish(routingKey string, body []byte) error {
+	return rabbitmq.PublishToExchange(p.ch, "leilao_events", routingKey, body)
+}
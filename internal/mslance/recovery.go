@@ -0,0 +1,152 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	recoveryAttempts = 5
+	recoveryBackoff  = 2 * time.Second
+)
+
+var recoveryClient = &http.Client{Timeout: 5 * time.Second}
+
+// Recover reconstrói o estado do mslance quando ele sobe: primeiro o que foi
+// gravado no StateStore, depois os leilões em aberto segundo o msleilao. Deve
+// ser chamada antes dos Listen*, para que nenhum lance da fila chegue a um
+// leilão que ainda não foi recuperado. Se o msleilao não responder, o mslance
+// segue só com o estado local e os eventos que estiverem nas filas.
+// internalToken é o token de serviço exigido pelas rotas internas do msleilao
+func (m *MSLance) Recover(msLeilaoHost, internalToken string) error {
+	estado, err := m.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	for _, status := range estado.Leiloes {
+		status := status
+		m.leiloes.Store(status.ID, m.newActor(&status))
+	}
+
+	m.creditosMu.Lock()
+	for user, saldo := range estado.Creditos {
+		m.creditos[user] = saldo
+	}
+	for compra := range estado.Compras {
+		m.compras[compra] = true
+	}
+	m.creditosMu.Unlock()
+
+	log.Printf("Estado local recuperado: %d leilões, %d saldos de créditos", len(estado.Leiloes), len(estado.Creditos))
+
+	abertos, err := fetchOpenAuctions(msLeilaoHost, internalToken)
+	if err != nil {
+		return fmt.Errorf("failed to fetch open auctions: %w", err)
+	}
+
+	emAberto := make(map[string]bool, len(abertos))
+	for _, aberto := range abertos {
+		emAberto[aberto.ID] = true
+		m.reconcile(aberto)
+	}
+	m.encerrarAusentes(emAberto)
+	log.Printf("%d leilões em aberto conferidos com o msleilao", len(abertos))
+
+	return nil
+}
+
+// encerrarAusentes desativa os leilões locais que o msleilao não tem mais em
+// aberto: foram cancelados com o mslance fora do ar. O leilao.cancelado ainda
+// está na fila e marca o cancelamento, mas pode chegar depois dos primeiros
+// lances, que até lá já são recusados
+func (m *MSLance) encerrarAusentes(emAberto map[string]bool) {
+	m.leiloes.Range(func(key, value any) bool {
+		if emAberto[key.(string)] {
+			return true
+		}
+		value.(*leilaoActor).call(func(leilao *LeilaoStatus) {
+			if leilao.Ativo && !leilao.Encerrado {
+				log.Printf("Leilão %s não está mais em aberto no msleilao, desativando", leilao.ID)
+				leilao.Ativo = false
+			}
+		})
+		return true
+	})
+}
+
+func fetchOpenAuctions(host, token string) ([]models.LeilaoAberto, error) {
+	url := fmt.Sprintf("http://%s/internal/open-auctions", host)
+
+	var lastErr error
+	for tentativa := 1; tentativa <= recoveryAttempts; tentativa++ {
+		abertos, err := getOpenAuctions(url, token)
+		if err == nil {
+			return abertos, nil
+		}
+		lastErr = err
+		log.Printf("msleilao indisponível (tentativa %d de %d): %v", tentativa, recoveryAttempts, err)
+		time.Sleep(recoveryBackoff)
+	}
+	return nil, lastErr
+}
+
+func getOpenAuctions(url, token string) ([]models.LeilaoAberto, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Internal-Token", token)
+
+	resp, err := recoveryClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var abertos []models.LeilaoAberto
+	if err := json.NewDecoder(resp.Body).Decode(&abertos); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return abertos, nil
+}
+
+// reconcile acerta um leilão local com o que o msleilao sabe dele. Um leilão
+// que o mslance não conhecia é criado sem lances. Um leilão que o msleilao já
+// finalizou e cujo resultado nunca saiu daqui é encerrado agora, publicando o
+// leilao.vencedor que o msleilao espera
+func (m *MSLance) reconcile(aberto models.LeilaoAberto) {
+	a, ok := m.actor(aberto.ID)
+	if !ok {
+		if err := aberto.CheckCurrency(); err != nil {
+			log.Printf("Leilão %s ignorado na recuperação: %v", aberto.ID, err)
+			return
+		}
+		a = m.newActor(m.newLeilaoStatus(aberto.LeilaoIniciado))
+		m.leiloes.Store(aberto.ID, a)
+		log.Printf("Leilão %s recuperado do msleilao sem lances locais", aberto.ID)
+	}
+
+	a.call(func(leilao *LeilaoStatus) {
+		// edições e quedas de preço podem ter acontecido com o mslance fora
+		leilao.Fim = aberto.DataFim
+		leilao.SoftCloseWindow = aberto.SoftCloseWindow
+		leilao.SoftCloseExtension = aberto.SoftCloseExtension
+		if leilao.Tipo == models.AuctionDutch && leilao.Ativo && aberto.PrecoAtual.IsPositive() {
+			leilao.PrecoAtual = aberto.PrecoAtual
+		}
+
+		if aberto.Encerrado && !leilao.Encerrado && !leilao.Cancelado {
+			log.Printf("Leilão %s foi finalizado com o mslance fora do ar, publicando o resultado", aberto.ID)
+			m.closeLeilao(leilao)
+		}
+	})
+}
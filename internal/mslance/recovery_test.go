@@ -0,0 +1,154 @@
+package mslance
+
+import (
+	"auction-system/pkg/clock"
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const tokenInterno = "segredo"
+
+// msLeilaoFalso responde /internal/open-auctions com abertos, exigindo o
+// token de serviço como o msleilao
+func msLeilaoFalso(t *testing.T, abertos []models.LeilaoAberto) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/internal/open-auctions" || r.Header.Get("X-Internal-Token") != tokenInterno {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(abertos)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+// antesDoRestart sobe um mslance com o estado em path, inicia ini, registra
+// um lance de A e fecha o arquivo, como se o serviço tivesse caído
+func antesDoRestart(t *testing.T, path string, ini models.LeilaoIniciado) {
+	t.Helper()
+
+	store, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &lanceHarness{clk: clock.NewFake(t0), pub: &recordingPublisher{}, history: &memHistory{}}
+	h.MSLance = newMSLance(h.pub, h.clk, h.history, store)
+	h.leiloes.Store(ini.ID, h.newActor(h.newLeilaoStatus(ini)))
+
+	if err := h.bid(ini.ID, "A", 1000, 0); err != nil {
+		t.Fatalf("A: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// depoisDoRestart reabre o estado e recupera o mslance contra o msleilao falso
+func depoisDoRestart(t *testing.T, path string, abertos []models.LeilaoAberto) *lanceHarness {
+	t.Helper()
+
+	store, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	h := &lanceHarness{clk: clock.NewFake(t0.Add(time.Minute)), pub: &recordingPublisher{}, history: &memHistory{}}
+	h.MSLance = newMSLance(h.pub, h.clk, h.history, store)
+	if err := h.Recover(msLeilaoFalso(t, abertos), tokenInterno); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	return h
+}
+
+func leilaoParaRecuperar() models.LeilaoIniciado {
+	return models.LeilaoIniciado{
+		ID:            models.NewAuctionID(),
+		DataInicio:    t0,
+		DataFim:       t0.Add(time.Hour),
+		StartingPrice: money.New(1000),
+		Increments:    models.IncrementTable{{Step: money.New(100)}},
+	}
+}
+
+func TestRecoverKeepsBidsAndAppliesChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	ini := leilaoParaRecuperar()
+	antesDoRestart(t, path, ini)
+
+	// com o mslance fora o leilão foi prorrogado
+	alterado := ini
+	alterado.DataFim = t0.Add(2 * time.Hour)
+	h := depoisDoRestart(t, path, []models.LeilaoAberto{{LeilaoIniciado: alterado}})
+
+	hb := h.highest(t, ini.ID)
+	if !hb.MaiorLance.Equal(money.New(1000)) {
+		t.Errorf("highest bid = %s after restart, want A's bid", hb.MaiorLance)
+	}
+	if !hb.Fim.Equal(alterado.DataFim) {
+		t.Errorf("end = %s after restart, want the one from msleilao", hb.Fim)
+	}
+	if err := h.bid(ini.ID, "B", 1000, 0); codigo(err) != models.RejeicaoAbaixoMinimo {
+		t.Errorf("B at A's price = %v, want below_minimum", err)
+	}
+}
+
+func TestRecoverPublishesMissedResult(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	ini := leilaoParaRecuperar()
+	antesDoRestart(t, path, ini)
+
+	h := depoisDoRestart(t, path, []models.LeilaoAberto{{LeilaoIniciado: ini, Encerrado: true}})
+
+	var vencedores []models.LeilaoVencedor
+	h.pub.take(t, "leilao.vencedor", &vencedores)
+	if len(vencedores) != 1 || vencedores[0].UserID != "A" {
+		t.Fatalf("leilao.vencedor = %+v, want A", vencedores)
+	}
+	if err := h.bid(ini.ID, "B", 5000, 0); codigo(err) != models.RejeicaoLeilaoInativo {
+		t.Errorf("bid after the missed close = %v, want auction_not_active", err)
+	}
+}
+
+func TestRecoverDeactivatesCancelledAuction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	ini := leilaoParaRecuperar()
+	antesDoRestart(t, path, ini)
+
+	// cancelado com o mslance fora: o msleilao não o lista mais
+	h := depoisDoRestart(t, path, nil)
+
+	if err := h.bid(ini.ID, "B", 5000, 0); codigo(err) != models.RejeicaoLeilaoInativo {
+		t.Errorf("bid on a cancelled auction = %v, want auction_not_active", err)
+	}
+	var vencedores []models.LeilaoVencedor
+	h.pub.take(t, "leilao.vencedor", &vencedores)
+	if len(vencedores) != 0 {
+		t.Errorf("leilao.vencedor = %+v for a cancelled auction, want none", vencedores)
+	}
+}
+
+func TestRecoverCreatesUnknownAuction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	ini := leilaoParaRecuperar()
+	h := depoisDoRestart(t, path, []models.LeilaoAberto{{LeilaoIniciado: ini}})
+
+	if err := h.bid(ini.ID, "A", 1000, 0); err != nil {
+		t.Fatalf("bid on an auction learned from msleilao: %v", err)
+	}
+}
+
+func TestOpenAuctionsRequireToken(t *testing.T) {
+	if _, err := getOpenAuctions("http://"+msLeilaoFalso(t, nil)+"/internal/open-auctions", "errado"); err == nil {
+		t.Fatal("open auctions fetched with the wrong token")
+	}
+}
@@ -0,0 +1,36 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+)
+
+// ProximoLanceMaximo é o maior valor aceito no leilão reverso: o preço teto
+// enquanto ninguém deu lance, depois o menor lance menos o incremento da faixa
+// em que ele está
+func (l *LeilaoStatus) ProximoLanceMaximo() (money.Money, error) {
+	if l.Vencedor == "" {
+		return l.CeilingPrice, nil
+	}
+	return l.MaiorLance.Sub(l.Increments.StepFor(l.MaiorLance))
+}
+
+// reservaAtingida diz se o melhor lance cobre a reserva. No reverso a reserva
+// é o preço máximo que o comprador aceita pagar
+func (l *LeilaoStatus) reservaAtingida() bool {
+	if l.Tipo == models.AuctionReverse {
+		return l.ReservePrice.IsZero() || !l.MaiorLance.GreaterThan(l.ReservePrice)
+	}
+	return !l.MaiorLance.LessThan(l.ReservePrice)
+}
+
+// makeReverseBid aceita o lance que ficou abaixo do melhor lance atual. No
+// leilão reverso MaiorLance guarda o menor lance
+func (m *MSLance) makeReverseBid(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	leilao.MaiorLance = bid.Valor
+	leilao.Vencedor = bid.UserID
+
+	m.publishValidado(leilao)
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"fmt"
+)
+
+// Rejeicao é a recusa de um lance: um código estável para os clientes e o
+// motivo para mostrar ao usuário. É o erro devolvido por MakeBid
+type Rejeicao struct {
+	Codigo models.CodigoRejeicao
+	Motivo string
+}
+
+func (r *Rejeicao) Error() string {
+	return r.Motivo
+}
+
+func rejeitar(codigo models.CodigoRejeicao, format string, args ...any) *Rejeicao {
+	return &Rejeicao{Codigo: codigo, Motivo: fmt.Sprintf(format, args...)}
+}
+
+// motivosReservados são as recusas cujo motivo só pode ir para quem deu o
+// lance. No histórico, que é público, fica o texto genérico
+var motivosReservados = map[models.CodigoRejeicao]string{
+	// o motivo traz o lance máximo do líder
+	models.RejeicaoMaximoNaoAumentado: "Lance máximo não foi aumentado",
+}
+
+// motivoPublico é o motivo da recusa como pode aparecer no histórico
+func (r *Rejeicao) motivoPublico() string {
+	if motivo, ok := motivosReservados[r.Codigo]; ok {
+		return motivo
+	}
+	return r.Motivo
+}
+
+// rejeitarMoeda recusa o lance cuja conta com os valores do leilão falhou, o
+// que só acontece quando as moedas não batem
+func rejeitarMoeda(err error) *Rejeicao {
+	return rejeitar(models.RejeicaoMoeda, "Moeda inválida: %v", err)
+}
+
+// BidRule é uma validação de lance. Check roda na goroutine do leilão, não
+// altera o estado e devolve nil quando o lance passa
+type BidRule interface {
+	Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao
+}
+
+// BidRules é a cadeia de regras de cada tipo de leilão, avaliada em ordem até
+// a primeira recusa
+type BidRules map[models.AuctionType][]BidRule
+
+// regrasComuns valem para todo lance, inclusive a compra imediata
+func regrasComuns(bloqueados []string, regras ...BidRule) []BidRule {
+	return append([]BidRule{
+		AuctionActive{},
+		NewUserNotBlocked(bloqueados),
+		NotSeller{},
+		BidLimit{},
+	}, regras...)
+}
+
+// DefaultBidRules monta as cadeias usadas pelo mslance. bloqueados são os
+// usuários impedidos de dar lances em qualquer leilão
+func DefaultBidRules(bloqueados []string) BidRules {
+	comuns := func(regras ...BidRule) []BidRule {
+		return regrasComuns(bloqueados, regras...)
+	}
+
+	return BidRules{
+		models.AuctionEnglish:          comuns(MaxQuantity{}, NoProxy{MultiUnitOnly: true}, MinimumBid{}),
+		models.AuctionSealedFirstPrice: comuns(MaxQuantity{}, NoProxy{}, MinimumBid{}),
+		models.AuctionVickrey:          comuns(MaxQuantity{}, NoProxy{}, MinimumBid{}),
+		models.AuctionDutch:            comuns(NoProxy{}, CurrentPrice{}),
+		models.AuctionReverse:          comuns(NoProxy{}, PositiveBid{}, MaximumBid{}),
+		models.AuctionPenny:            comuns(NoProxy{}, NotLeading{}),
+	}
+}
+
+// DefaultBuyNowRules monta a cadeia da compra imediata: as regras comuns a
+// todo lance e a disponibilidade da compra
+func DefaultBuyNowRules(bloqueados []string) []BidRule {
+	return regrasComuns(bloqueados, BuyNowAvailable{})
+}
+
+// AuctionActive recusa lances em leilões cancelados ou fora do horário
+type AuctionActive struct{}
+
+func (AuctionActive) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if leilao.Cancelado {
+		return rejeitar(models.RejeicaoLeilaoCancelado, "Leilão cancelado")
+	}
+	if !leilao.Ativo {
+		return rejeitar(models.RejeicaoLeilaoInativo, "Leilão não está ativo")
+	}
+	return nil
+}
+
+// UserNotBlocked recusa lances de usuários bloqueados
+type UserNotBlocked struct {
+	bloqueados map[string]bool
+}
+
+func NewUserNotBlocked(userIDs []string) UserNotBlocked {
+	bloqueados := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		bloqueados[id] = true
+	}
+	return UserNotBlocked{bloqueados: bloqueados}
+}
+
+func (r UserNotBlocked) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if r.bloqueados[bid.UserID] {
+		return rejeitar(models.RejeicaoUsuarioBloqueado, "Usuário bloqueado para lances")
+	}
+	return nil
+}
+
+// NotSeller impede o vendedor de dar lances no próprio leilão
+type NotSeller struct{}
+
+func (NotSeller) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if leilao.SellerID != "" && bid.UserID == leilao.SellerID {
+		return rejeitar(models.RejeicaoVendedor, "O vendedor não pode dar lances no próprio leilão")
+	}
+	return nil
+}
+
+// BidLimit aplica o limite de lances aceitos por participante do leilão
+type BidLimit struct{}
+
+func (BidLimit) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if leilao.MaxBidsPerUser > 0 && leilao.LancesPorUsuario[bid.UserID] >= leilao.MaxBidsPerUser {
+		return rejeitar(models.RejeicaoLimiteLances, "Limite de %d lances por participante atingido", leilao.MaxBidsPerUser)
+	}
+	return nil
+}
+
+// NoProxy recusa o lance automático. Com MultiUnitOnly só recusa nos leilões
+// de várias unidades
+type NoProxy struct {
+	MultiUnitOnly bool
+}
+
+func (r NoProxy) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if !bid.ValorMaximo.IsPositive() || (r.MultiUnitOnly && leilao.Quantidade <= 1) {
+		return nil
+	}
+	return rejeitar(models.RejeicaoLanceAutomatico, "Lance automático não é aceito em %s", nomeModalidade(leilao))
+}
+
+func nomeModalidade(leilao *LeilaoStatus) string {
+	switch {
+	case leilao.Quantidade > 1:
+		return "leilão de várias unidades"
+	case leilao.Tipo == models.AuctionDutch:
+		return "leilão holandês"
+	case leilao.Tipo == models.AuctionReverse:
+		return "leilão reverso"
+	case leilao.Tipo == models.AuctionPenny:
+		return "leilão de centavos"
+	case leilao.Tipo.Sealed():
+		return "leilão selado"
+	}
+	return "leilão inglês"
+}
+
+// MaxQuantity recusa pedidos de mais unidades do que o lote tem
+type MaxQuantity struct{}
+
+func (MaxQuantity) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if leilao.Quantidade > 1 && bid.Quantidade > leilao.Quantidade {
+		return rejeitar(models.RejeicaoQuantidade, "Quantidade máxima: %d", leilao.Quantidade)
+	}
+	return nil
+}
+
+// MinimumBid exige o incremento mínimo sobre o maior lance. No lance
+// automático vale o máximo informado, e o líder só pode subir o próprio máximo
+type MinimumBid struct{}
+
+func (MinimumBid) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if leilao.Quantidade > 1 {
+		// no leilão aberto a proposta só sobe: quem já leva unidades não pode
+		// baixar para o preço inicial depois de afastar os concorrentes
+		if atual, ok := leilao.propostaDe(bid.UserID); ok && !leilao.Tipo.Sealed() && bid.Valor.LessThan(atual.Valor) {
+			return rejeitar(models.RejeicaoAbaixoMinimo, "Sua proposta atual já é %s e não pode ser reduzida", atual.Valor)
+		}
+		minimo, err := leilao.minimoMultiUnidade(bid.UserID, max(bid.Quantidade, 1))
+		if err != nil {
+			return rejeitarMoeda(err)
+		}
+		if bid.Valor.LessThan(minimo) {
+			return rejeitar(models.RejeicaoAbaixoMinimo, "Lance mínimo aceito: %s", minimo)
+		}
+		return nil
+	}
+
+	limite := limiteDoLance(bid)
+	if leilao.Vencedor == bid.UserID && bid.ValorMaximo.IsPositive() {
+		if !limite.GreaterThan(leilao.MaximoVencedor) {
+			return rejeitar(models.RejeicaoMaximoNaoAumentado, "Seu lance máximo atual já é %s", leilao.MaximoVencedor)
+		}
+		return nil
+	}
+
+	minimo, err := leilao.ProximoLanceMinimo()
+	if err != nil {
+		return rejeitarMoeda(err)
+	}
+	if limite.LessThan(minimo) {
+		return rejeitar(models.RejeicaoAbaixoMinimo, "Lance mínimo aceito: %s", minimo)
+	}
+	return nil
+}
+
+// CurrentPrice exige que o lance do leilão holandês cubra o preço anunciado
+type CurrentPrice struct{}
+
+func (CurrentPrice) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if bid.Valor.LessThan(leilao.PrecoAtual) {
+		return rejeitar(models.RejeicaoAbaixoPreco, "Preço atual: %s", leilao.PrecoAtual)
+	}
+	return nil
+}
+
+// PositiveBid recusa lances zerados ou negativos
+type PositiveBid struct{}
+
+func (PositiveBid) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if !bid.Valor.IsPositive() {
+		return rejeitar(models.RejeicaoNaoPositivo, "Lance deve ser positivo")
+	}
+	return nil
+}
+
+// MaximumBid exige que o lance do leilão reverso fique abaixo do melhor lance
+// por pelo menos um incremento
+type MaximumBid struct{}
+
+func (MaximumBid) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	maximo, err := leilao.ProximoLanceMaximo()
+	if err != nil {
+		return rejeitarMoeda(err)
+	}
+	if bid.Valor.GreaterThan(maximo) {
+		return rejeitar(models.RejeicaoAcimaMaximo, "Lance máximo aceito: %s", maximo)
+	}
+	return nil
+}
+
+// BuyNowAvailable recusa a compra imediata depois que os lances passaram do
+// limite configurado
+type BuyNowAvailable struct{}
+
+func (BuyNowAvailable) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if !leilao.CompraImediataDisponivel() {
+		return rejeitar(models.RejeicaoCompraIndisponivel, "Compra imediata não está disponível")
+	}
+	return nil
+}
+
+// NotLeading impede quem já lidera o leilão de centavos de gastar outro crédito
+type NotLeading struct{}
+
+func (NotLeading) Check(leilao *LeilaoStatus, bid models.LanceRealizado) *Rejeicao {
+	if leilao.Vencedor == bid.UserID {
+		return rejeitar(models.RejeicaoJaLider, "Você já tem o maior lance")
+	}
+	return nil
+}
+
+// limiteDoLance é até onde o lance vai: o máximo do lance automático, ou o
+// próprio valor
+func limiteDoLance(bid models.LanceRealizado) money.Money {
+	if bid.ValorMaximo.IsPositive() {
+		return bid.ValorMaximo
+	}
+	return bid.Valor
+}
@@ -0,0 +1,153 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestDefaultBidRulesOrder(t *testing.T) {
+	comuns := []string{"AuctionActive", "UserNotBlocked", "NotSeller", "BidLimit"}
+	want := map[models.AuctionType][]string{
+		models.AuctionEnglish:          {"MaxQuantity", "NoProxy", "MinimumBid"},
+		models.AuctionSealedFirstPrice: {"MaxQuantity", "NoProxy", "MinimumBid"},
+		models.AuctionVickrey:          {"MaxQuantity", "NoProxy", "MinimumBid"},
+		models.AuctionDutch:            {"NoProxy", "CurrentPrice"},
+		models.AuctionReverse:          {"NoProxy", "PositiveBid", "MaximumBid"},
+		models.AuctionPenny:            {"NoProxy", "NotLeading"},
+	}
+
+	regras := DefaultBidRules(nil)
+	if len(regras) != len(want) {
+		t.Errorf("DefaultBidRules has %d auction types, want %d", len(regras), len(want))
+	}
+	for tipo, especificas := range want {
+		var got []string
+		for _, r := range regras[tipo] {
+			got = append(got, fmt.Sprintf("%T", r)[len("mslance."):])
+		}
+		if w := append(slices.Clone(comuns), especificas...); !slices.Equal(got, w) {
+			t.Errorf("%s rules = %v, want %v", tipo, got, w)
+		}
+	}
+}
+
+// etapa corrige um dos problemas do lance; depois dela a cadeia deve recusar
+// com o código da regra seguinte, ou aceitar se want for vazio
+type etapa struct {
+	corrige func(*LeilaoStatus, *models.LanceRealizado)
+	want    models.CodigoRejeicao
+}
+
+// TestDefaultBidRulesFirstRejection parte de um lance que quebra todas as
+// regras do tipo e corrige um problema por vez: a cada passo a recusa vem da
+// primeira regra ainda violada
+func TestDefaultBidRulesFirstRejection(t *testing.T) {
+	// V está bloqueado; X é o vendedor e já gastou o limite de lances
+	comuns := []etapa{
+		{func(*LeilaoStatus, *models.LanceRealizado) {}, models.RejeicaoLeilaoInativo},
+		{func(l *LeilaoStatus, _ *models.LanceRealizado) { l.Ativo = true }, models.RejeicaoUsuarioBloqueado},
+		{func(_ *LeilaoStatus, b *models.LanceRealizado) { b.UserID = "X" }, models.RejeicaoVendedor},
+		{func(l *LeilaoStatus, _ *models.LanceRealizado) { l.SellerID = "S" }, models.RejeicaoLimiteLances},
+	}
+	semLimite := func(l *LeilaoStatus, _ *models.LanceRealizado) { l.MaxBidsPerUser = 0 }
+	semProxy := func(_ *LeilaoStatus, b *models.LanceRealizado) { b.ValorMaximo = money.Money{} }
+	valor := func(v int64) func(*LeilaoStatus, *models.LanceRealizado) {
+		return func(_ *LeilaoStatus, b *models.LanceRealizado) { b.Valor = money.New(v) }
+	}
+
+	tests := []struct {
+		name   string
+		leilao LeilaoStatus
+		lance  models.LanceRealizado
+		etapas []etapa
+	}{
+		{
+			name:   "english",
+			leilao: LeilaoStatus{Tipo: models.AuctionEnglish},
+			lance:  models.LanceRealizado{Valor: money.New(500)},
+			etapas: []etapa{{semLimite, models.RejeicaoAbaixoMinimo}, {valor(1000), ""}},
+		},
+		{
+			name:   "english multi-unit",
+			leilao: LeilaoStatus{Tipo: models.AuctionEnglish, Quantidade: 3},
+			lance:  models.LanceRealizado{Valor: money.New(500), ValorMaximo: money.New(9000), Quantidade: 5},
+			etapas: []etapa{
+				{semLimite, models.RejeicaoQuantidade},
+				{func(_ *LeilaoStatus, b *models.LanceRealizado) { b.Quantidade = 1 }, models.RejeicaoLanceAutomatico},
+				{semProxy, models.RejeicaoAbaixoMinimo},
+				{valor(1000), ""},
+			},
+		},
+		{
+			name:   "sealed first price",
+			leilao: LeilaoStatus{Tipo: models.AuctionSealedFirstPrice},
+			lance:  models.LanceRealizado{Valor: money.New(500), ValorMaximo: money.New(9000)},
+			etapas: []etapa{{semLimite, models.RejeicaoLanceAutomatico}, {semProxy, models.RejeicaoAbaixoMinimo}, {valor(1000), ""}},
+		},
+		{
+			name:   "vickrey",
+			leilao: LeilaoStatus{Tipo: models.AuctionVickrey},
+			lance:  models.LanceRealizado{Valor: money.New(500), ValorMaximo: money.New(9000)},
+			etapas: []etapa{{semLimite, models.RejeicaoLanceAutomatico}, {semProxy, models.RejeicaoAbaixoMinimo}, {valor(1000), ""}},
+		},
+		{
+			name:   "dutch",
+			leilao: LeilaoStatus{Tipo: models.AuctionDutch, PrecoAtual: money.New(5000)},
+			lance:  models.LanceRealizado{Valor: money.New(4000), ValorMaximo: money.New(9000)},
+			etapas: []etapa{{semLimite, models.RejeicaoLanceAutomatico}, {semProxy, models.RejeicaoAbaixoPreco}, {valor(5000), ""}},
+		},
+		{
+			name:   "reverse",
+			leilao: LeilaoStatus{Tipo: models.AuctionReverse, CeilingPrice: money.New(10000)},
+			lance:  models.LanceRealizado{ValorMaximo: money.New(9000)},
+			etapas: []etapa{
+				{semLimite, models.RejeicaoLanceAutomatico},
+				{semProxy, models.RejeicaoNaoPositivo},
+				{valor(20000), models.RejeicaoAcimaMaximo},
+				{valor(9000), ""},
+			},
+		},
+		{
+			name:   "penny",
+			leilao: LeilaoStatus{Tipo: models.AuctionPenny, Vencedor: "X", MaiorLance: money.New(1000), Penny: &models.PennyParams{Increment: money.New(1), Timer: 10}},
+			lance:  models.LanceRealizado{ValorMaximo: money.New(9000)},
+			etapas: []etapa{
+				{semLimite, models.RejeicaoLanceAutomatico},
+				{semProxy, models.RejeicaoJaLider},
+				{func(l *LeilaoStatus, _ *models.LanceRealizado) { l.Vencedor = "W" }, ""},
+			},
+		},
+	}
+
+	regras := DefaultBidRules([]string{"V"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leilao := tt.leilao
+			leilao.SellerID = "X"
+			leilao.MaxBidsPerUser = 1
+			leilao.LancesPorUsuario = map[string]int{"X": 1}
+			leilao.StartingPrice = money.New(1000)
+			leilao.Increments = models.IncrementTable{{Step: money.New(100)}}
+			leilao.Quantidade = max(leilao.Quantidade, 1)
+			lance := tt.lance
+			lance.UserID = "V"
+
+			for i, e := range append(slices.Clone(comuns), tt.etapas...) {
+				e.corrige(&leilao, &lance)
+				var got models.CodigoRejeicao
+				for _, r := range regras[leilao.Tipo] {
+					if rej := r.Check(&leilao, lance); rej != nil {
+						got = rej.Codigo
+						break
+					}
+				}
+				if got != e.want {
+					t.Fatalf("step %d: first rejection = %q, want %q", i, got, e.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package mslance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StateStore guarda o estado do mslance para que um restart no meio de um
+// leilão não perca os lances nem os créditos
+type StateStore interface {
+	// SaveLeilao grava o estado do leilão. É chamada só pela goroutine do
+	// leilão, então nunca ao mesmo tempo para o mesmo leilão
+	SaveLeilao(status LeilaoStatus) error
+	// SaveCreditos grava o novo saldo do usuário. transactionID é a compra que
+	// gerou o saldo, vazio quando ele mudou por um lance
+	SaveCreditos(userID string, saldo int, transactionID string) error
+	// Load devolve o estado como estava quando o serviço subiu
+	Load() (EstadoSalvo, error)
+}
+
+type EstadoSalvo struct {
+	// Leiloes tem o último estado gravado de cada leilão
+	Leiloes  []LeilaoStatus
+	Creditos map[string]int
+	// Compras são as compras de créditos já somadas ao saldo
+	Compras map[string]bool
+}
+
+// registroEstado é uma linha do arquivo: um leilão, um saldo ou uma compra
+type registroEstado struct {
+	Leilao   *LeilaoStatus  `json:"leilao,omitempty"`
+	Creditos *saldoCreditos `json:"creditos,omitempty"`
+	Compra   string         `json:"compra,omitempty"`
+}
+
+type saldoCreditos struct {
+	UserID        string `json:"user_id"`
+	Saldo         int    `json:"saldo"`
+	TransactionID string `json:"transaction_id,omitempty"`
+}
+
+// chave identifica o que a linha grava; só a última linha de cada chave vale
+func (r registroEstado) chave() string {
+	switch {
+	case r.Leilao != nil:
+		return "leilao/" + r.Leilao.ID
+	case r.Creditos != nil:
+		return "creditos/" + r.Creditos.UserID
+	}
+	return "compra/" + r.Compra
+}
+
+const (
+	// minCompactLines é o tamanho do log abaixo do qual nunca vale a pena compactar
+	minCompactLines = 1024
+	// maxLote limita quantas gravações dividem um mesmo fsync
+	maxLote = 256
+)
+
+// FileStateStore acrescenta cada alteração a um arquivo JSON Lines: o estado
+// inteiro do leilão, que é limitado (veja maxProcessados), ou o saldo de um
+// usuário. Vale a última linha de cada leilão e de cada usuário
+//
+// Só a goroutine de escrita mexe no arquivo. Ela junta as gravações que
+// chegaram enquanto o fsync anterior rodava e grava o lote com um fsync só,
+// então leilões diferentes não esperam uns pelos outros: quanto mais leilões
+// gravando ao mesmo tempo, mais gravações por fsync. O arquivo é compactado
+// para uma linha por chave ao abrir e sempre que passa do dobro disso
+type FileStateStore struct {
+	path     string
+	pedidos  chan gravacao
+	terminou chan struct{}
+
+	// leiloes, creditos e compras são o que foi lido na abertura
+	leiloes  map[string]LeilaoStatus
+	creditos map[string]int
+	compras  map[string]bool
+
+	// os campos abaixo são só da goroutine de escrita
+	file *os.File
+	// vivas é a última linha de cada chave, o conteúdo da compactação
+	vivas map[string][]byte
+	// lines é quantas linhas o arquivo tem desde a última compactação
+	lines int
+}
+
+type gravacao struct {
+	linhas []linhaEstado
+	// feito recebe o resultado depois do fsync do lote
+	feito chan error
+}
+
+type linhaEstado struct {
+	chave string
+	dados []byte
+}
+
+func NewFileStateStore(path string) (*FileStateStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+
+	s := &FileStateStore{
+		path:     path,
+		pedidos:  make(chan gravacao, maxLote),
+		terminou: make(chan struct{}),
+		leiloes:  make(map[string]LeilaoStatus),
+		creditos: make(map[string]int),
+		compras:  make(map[string]bool),
+		vivas:    make(map[string][]byte),
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 16<<20)
+		for scanner.Scan() {
+			var rec registroEstado
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				// uma linha cortada por um crash no meio da escrita é descartada
+				continue
+			}
+			s.aplicar(rec)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// aplicar guarda o registro lido na abertura
+func (s *FileStateStore) aplicar(rec registroEstado) {
+	if rec.Leilao != nil {
+		s.leiloes[rec.Leilao.ID] = *rec.Leilao
+	}
+	if rec.Creditos != nil {
+		s.creditos[rec.Creditos.UserID] = rec.Creditos.Saldo
+		if rec.Creditos.TransactionID != "" {
+			s.compras[rec.Creditos.TransactionID] = true
+			s.lembrarLinha(registroEstado{Compra: rec.Creditos.TransactionID})
+		}
+		// a compra já ficou na própria linha; o saldo vale sem ela
+		rec = registroEstado{Creditos: &saldoCreditos{UserID: rec.Creditos.UserID, Saldo: rec.Creditos.Saldo}}
+	}
+	if rec.Compra != "" {
+		s.compras[rec.Compra] = true
+	}
+	s.lembrarLinha(rec)
+}
+
+func (s *FileStateStore) lembrarLinha(rec registroEstado) {
+	line, err := json.Marshal(rec)
+	if err == nil {
+		s.vivas[rec.chave()] = line
+	}
+}
+
+func (s *FileStateStore) SaveLeilao(status LeilaoStatus) error {
+	return s.gravar(registroEstado{Leilao: &status})
+}
+
+func (s *FileStateStore) SaveCreditos(userID string, saldo int, transactionID string) error {
+	saldoRec := registroEstado{Creditos: &saldoCreditos{UserID: userID, Saldo: saldo}}
+	if transactionID == "" {
+		return s.gravar(saldoRec)
+	}
+	return s.gravar(saldoRec, registroEstado{Compra: transactionID})
+}
+
+// gravar codifica os registros na goroutine de quem chamou, entrega as linhas
+// à goroutine de escrita e espera o fsync do lote em que elas entraram. Os
+// registros de uma chamada ficam sempre no mesmo lote
+func (s *FileStateStore) gravar(registros ...registroEstado) error {
+	g := gravacao{feito: make(chan error, 1)}
+	for _, rec := range registros {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to encode state: %w", err)
+		}
+		g.linhas = append(g.linhas, linhaEstado{chave: rec.chave(), dados: line})
+	}
+
+	s.pedidos <- g
+	return <-g.feito
+}
+
+func (s *FileStateStore) Load() (EstadoSalvo, error) {
+	estado := EstadoSalvo{
+		Leiloes:  make([]LeilaoStatus, 0, len(s.leiloes)),
+		Creditos: make(map[string]int, len(s.creditos)),
+		Compras:  make(map[string]bool, len(s.compras)),
+	}
+	for _, l := range s.leiloes {
+		estado.Leiloes = append(estado.Leiloes, l)
+	}
+	for user, saldo := range s.creditos {
+		estado.Creditos[user] = saldo
+	}
+	for compra := range s.compras {
+		estado.Compras[compra] = true
+	}
+	return estado, nil
+}
+
+// Close espera as gravações pendentes e fecha o arquivo. Nenhum Save pode ser
+// chamado depois dele
+func (s *FileStateStore) Close() error {
+	close(s.pedidos)
+	<-s.terminou
+	return s.file.Close()
+}
+
+// run é a goroutine de escrita. Enquanto um lote está no fsync os próximos
+// pedidos se acumulam no canal e formam o lote seguinte
+func (s *FileStateStore) run() {
+	defer close(s.terminou)
+
+	for g := range s.pedidos {
+		lote := []gravacao{g}
+	juntar:
+		for len(lote) < maxLote {
+			select {
+			case g, ok := <-s.pedidos:
+				if !ok {
+					break juntar
+				}
+				lote = append(lote, g)
+			default:
+				break juntar
+			}
+		}
+
+		err := s.escrever(lote)
+		for _, g := range lote {
+			g.feito <- err
+		}
+	}
+}
+
+func (s *FileStateStore) escrever(lote []gravacao) error {
+	var buf bytes.Buffer
+	linhas := 0
+	for _, g := range lote {
+		for _, l := range g.linhas {
+			buf.Write(l.dados)
+			buf.WriteByte('\n')
+			s.vivas[l.chave] = l.dados
+			linhas++
+		}
+	}
+
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync state: %w", err)
+	}
+	s.lines += linhas
+
+	if s.lines > max(2*len(s.vivas), minCompactLines) {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact regrava o arquivo só com a última linha de cada chave, em um
+// arquivo temporário renomeado no fim, como o repositório do msleilao. Depois
+// dela as gravações seguem no arquivo novo
+func (s *FileStateStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, line := range s.vivas {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", s.path, err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.lines = len(s.vivas)
+	return nil
+}
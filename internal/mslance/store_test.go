@@ -0,0 +1,139 @@
+package mslance
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"bufio"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	n := 0
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16<<20)
+	for s.Scan() {
+		n++
+	}
+	return n
+}
+
+func TestFileStateStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+
+	s, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := models.NewAuctionID(), models.NewAuctionID()
+	for _, status := range []LeilaoStatus{
+		{ID: a, MaiorLance: money.New(1000)},
+		{ID: b, MaiorLance: money.New(500)},
+		{ID: a, MaiorLance: money.New(2000), Vencedor: "A"},
+	} {
+		if err := s.SaveLeilao(status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SaveCreditos("A", 3, "tx-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveCreditos("A", 2, ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	estado, _ := s.Load()
+	leiloes := map[string]LeilaoStatus{}
+	for _, l := range estado.Leiloes {
+		leiloes[l.ID] = l
+	}
+	if len(leiloes) != 2 || leiloes[a].Vencedor != "A" || !leiloes[a].MaiorLance.Equal(money.New(2000)) {
+		t.Fatalf("Leiloes = %+v, want the last state of each auction", estado.Leiloes)
+	}
+	if estado.Creditos["A"] != 2 || !estado.Compras["tx-1"] {
+		t.Errorf("Creditos = %v, Compras = %v, want the last balance and the purchase", estado.Creditos, estado.Compras)
+	}
+	// dois leilões, um saldo e uma compra
+	if n := countLines(t, path); n != 4 {
+		t.Errorf("file has %d lines after reopening, want one per key", n)
+	}
+}
+
+func TestFileStateStoreCompactsLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+
+	s, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	id := models.NewAuctionID()
+	for n := range 3 * minCompactLines {
+		if err := s.SaveLeilao(LeilaoStatus{ID: id, MaiorLance: money.New(int64(n))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countLines(t, path); n > minCompactLines {
+		t.Errorf("file has %d lines for one auction, want at most %d", n, minCompactLines)
+	}
+}
+
+func TestFileStateStoreConcurrentSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+
+	s, err := NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, 32)
+	var wg sync.WaitGroup
+	for i := range ids {
+		ids[i] = models.NewAuctionID()
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for n := range 20 {
+				if err := s.SaveLeilao(LeilaoStatus{ID: id, MaiorLance: money.New(int64(n))}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(ids[i])
+	}
+	wg.Wait()
+	s.Close()
+
+	s, err = NewFileStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	estado, _ := s.Load()
+	if len(estado.Leiloes) != len(ids) {
+		t.Fatalf("%d auctions after reopening, want %d", len(estado.Leiloes), len(ids))
+	}
+	for _, l := range estado.Leiloes {
+		if !l.MaiorLance.Equal(money.New(19)) {
+			t.Errorf("auction %s = %s, want the last save", l.ID, l.MaiorLance)
+		}
+	}
+}
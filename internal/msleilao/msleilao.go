@@ -1,12 +1,14 @@
 package msleilao
 
 import (
+	"auction-system/pkg/clock"
 	"auction-system/pkg/models"
+	"auction-system/pkg/money"
 	"auction-system/pkg/rabbitmq"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,115 +21,982 @@ type Auction struct {
 	Descricao string    `json:"description"`
 	Inicio    time.Time `json:"start"`
 	Fim       time.Time `json:"end"`
-	Ativo     bool      `json:"active"`
+	Estado    State     `json:"state"`
+	// ReservePrice é o mínimo oculto definido pelo vendedor; nunca sai em ConsultAuctions
+	ReservePrice  money.Money           `json:"reserve_price,omitzero"`
+	StartingPrice money.Money           `json:"starting_price,omitzero"`
+	Increments    models.IncrementTable `json:"increments,omitempty"`
+	// lances dentro dos últimos SoftCloseWindow segundos estendem o fim em
+	// SoftCloseExtension segundos
+	SoftCloseWindow    int `json:"soft_close_window,omitempty"`
+	SoftCloseExtension int `json:"soft_close_extension,omitempty"`
+
+	Tipo  models.AuctionType  `json:"type,omitempty"`
+	Dutch *models.DutchParams `json:"dutch,omitempty"`
+	// PrecoAtual e ProximaQueda só são usados no leilão holandês
+	PrecoAtual   money.Money `json:"current_price,omitzero"`
+	ProximaQueda time.Time   `json:"next_price_drop,omitzero"`
+
+	// Quantidade é o número de unidades idênticas vendidas no leilão. Com mais
+	// de uma unidade cada vencedor paga separadamente, e o leilão só fica
+	// quitado depois que todos os pagamentos chegam
+	Quantidade          int `json:"quantity,omitempty"`
+	PagamentosPendentes int `json:"pending_payments,omitempty"`
+	PagamentosAprovados int `json:"approved_payments,omitempty"`
+
+	// CeilingPrice é o preço teto do leilão reverso, de onde os lances descem
+	CeilingPrice money.Money `json:"ceiling_price,omitzero"`
+
+	Penny *models.PennyParams `json:"penny,omitempty"`
+
+	// BuyNowPrice é o preço de compra imediata. Some quando os lances chegam a
+	// BuyNowThreshold, ou no primeiro lance se o limite for zero
+	BuyNowPrice     money.Money `json:"buy_now_price,omitzero"`
+	BuyNowThreshold money.Money `json:"buy_now_threshold,omitzero"`
+
+	// SellerID é quem vende; o mslance recusa lances dele no próprio leilão
+	SellerID string `json:"seller_id,omitempty"`
+	// MaxBidsPerUser limita os lances aceitos de cada participante; zero é sem limite
+	MaxBidsPerUser int `json:"max_bids_per_user,omitempty"`
 }
 
-type MsLeilao struct {
-	ch       *amqp.Channel
-	auctions []Auction
-	mu       sync.RWMutex
+// AuctionParams reúne os dados informados na criação de um leilão
+type AuctionParams struct {
+	Descricao     string
+	Inicio        time.Time
+	Fim           time.Time
+	ReservePrice  money.Money
+	StartingPrice money.Money
+	Increments    models.IncrementTable
+
+	SoftCloseWindow    int
+	SoftCloseExtension int
+
+	Tipo  models.AuctionType
+	Dutch *models.DutchParams
+
+	Quantidade   int
+	CeilingPrice money.Money
+
+	Penny *models.PennyParams
+
+	BuyNowPrice     money.Money
+	BuyNowThreshold money.Money
+
+	SellerID       string
+	MaxBidsPerUser int
 }
 
-func NewMsLeilao(ch *amqp.Channel) *MsLeilao {
-	// now := time.Now()
-	auctions := []Auction{
-		// {ID: "1", Descricao: "Almoço no RU", Inicio: now.Add(2 * time.Second), Fim: now.Add(50 * time.Second), Ativo: false},
-		// {ID: "2", Descricao: "Monalisa", Inicio: now.Add(20 * time.Second), Fim: now.Add(40 * time.Second), Ativo: false},
+// checkCurrency exige a moeda padrão em todos os valores do leilão: os lances
+// só são aceitos nela, e o mslance soma e compara os lances com esses valores
+func (p AuctionParams) checkCurrency() error {
+	valores := []money.Money{p.ReservePrice, p.StartingPrice, p.CeilingPrice, p.BuyNowPrice, p.BuyNowThreshold}
+	for _, tier := range p.Increments {
+		valores = append(valores, tier.Below, tier.Step)
+	}
+	if p.Dutch != nil {
+		valores = append(valores, p.Dutch.StartPrice, p.Dutch.FloorPrice, p.Dutch.Step)
+	}
+	if p.Penny != nil {
+		valores = append(valores, p.Penny.Increment)
 	}
+	return money.CheckCurrency(money.DefaultCurrency, valores...)
+}
+
+// AuctionUpdate carrega apenas os campos que o cliente quer alterar
+type AuctionUpdate struct {
+	Descricao *string
+	Inicio    *time.Time
+	Fim       *time.Time
+}
+
+var ErrAuctionClosed = errors.New("auction can no longer be changed")
 
-	return &MsLeilao{ch: ch, auctions: auctions}
+type MsLeilao struct {
+	ch        *amqp.Channel
+	pub       Publisher
+	repo      AuctionRepository
+	clock     clock.Clock
+	scheduler *Scheduler
+	mu        sync.Mutex
+}
+
+func NewMsLeilao(ch *amqp.Channel, repo AuctionRepository, clk clock.Clock) *MsLeilao {
+	l := newMsLeilao(amqpPublisher{ch: ch}, repo, clk)
+	l.ch = ch
+	return l
+}
+
+func newMsLeilao(pub Publisher, repo AuctionRepository, clk clock.Clock) *MsLeilao {
+	l := &MsLeilao{pub: pub, repo: repo, clock: clk}
+	l.scheduler = NewScheduler(clk, l.handleScheduledEvent)
+	return l
 }
 
-func (l *MsLeilao) CreateAuction(desc string, start time.Time, end time.Time) error {
-	now := time.Now()
+// CreateAuction valida e agenda um leilão novo, devolvendo-o com o ID gerado
+func (l *MsLeilao) CreateAuction(params AuctionParams) (Auction, error) {
+	now := l.clock.Now()
 
-	if strings.TrimSpace(desc) == "" {
-		return fmt.Errorf("description cannot be empty")
+	if strings.TrimSpace(params.Descricao) == "" {
+		return Auction{}, fmt.Errorf("description cannot be empty")
 	}
 
-	if start.Before(now) {
-		return fmt.Errorf("start time cannot be in the past")
+	if params.Inicio.Before(now) {
+		return Auction{}, fmt.Errorf("start time cannot be in the past")
 	}
 
-	if end.Before(now) {
-		return fmt.Errorf("end time cannot be in the past")
+	if params.Fim.Before(now) {
+		return Auction{}, fmt.Errorf("end time cannot be in the past")
 	}
 
-	if end.Before(start) {
-		return fmt.Errorf("end time cannot be before start time")
+	if params.Fim.Before(params.Inicio) {
+		return Auction{}, fmt.Errorf("end time cannot be before start time")
+	}
+
+	if err := params.checkCurrency(); err != nil {
+		return Auction{}, err
+	}
+
+	if params.ReservePrice.IsNegative() {
+		return Auction{}, fmt.Errorf("reserve price cannot be negative")
+	}
+
+	if params.StartingPrice.IsNegative() {
+		return Auction{}, fmt.Errorf("starting price cannot be negative")
+	}
+
+	if params.SoftCloseWindow < 0 || params.SoftCloseExtension < 0 {
+		return Auction{}, fmt.Errorf("soft close settings cannot be negative")
+	}
+
+	if params.SoftCloseWindow > 0 && params.SoftCloseExtension == 0 {
+		return Auction{}, fmt.Errorf("soft close extension is required when a soft close window is set")
+	}
+
+	tipo := params.Tipo.Normalize()
+	if !tipo.Valid() {
+		return Auction{}, fmt.Errorf("invalid auction type %q", params.Tipo)
+	}
+
+	if tipo == models.AuctionDutch {
+		if params.Dutch == nil {
+			return Auction{}, fmt.Errorf("dutch auctions require dutch settings")
+		}
+		if err := params.Dutch.Validate(); err != nil {
+			return Auction{}, err
+		}
+	} else if params.Dutch != nil {
+		return Auction{}, fmt.Errorf("dutch settings are only valid for dutch auctions")
+	}
+
+	if tipo.Sealed() && params.SoftCloseWindow > 0 {
+		return Auction{}, fmt.Errorf("sealed auctions cannot use soft close")
+	}
+
+	if tipo == models.AuctionReverse {
+		if !params.CeilingPrice.IsPositive() {
+			return Auction{}, fmt.Errorf("reverse auctions require a positive ceiling price")
+		}
+		if !params.StartingPrice.IsZero() {
+			return Auction{}, fmt.Errorf("reverse auctions use a ceiling price instead of a starting price")
+		}
+		if params.ReservePrice.GreaterThan(params.CeilingPrice) {
+			return Auction{}, fmt.Errorf("reserve price cannot be above the ceiling price")
+		}
+		if params.Quantidade > 1 {
+			return Auction{}, fmt.Errorf("reverse auctions buy a single unit")
+		}
+	} else if !params.CeilingPrice.IsZero() {
+		return Auction{}, fmt.Errorf("ceiling price is only valid for reverse auctions")
+	}
+
+	if tipo == models.AuctionPenny {
+		if params.Penny == nil {
+			return Auction{}, fmt.Errorf("penny auctions require penny settings")
+		}
+		if err := params.Penny.Validate(); err != nil {
+			return Auction{}, err
+		}
+		if params.SoftCloseWindow > 0 {
+			return Auction{}, fmt.Errorf("penny auctions already extend on every bid and cannot use soft close")
+		}
+		if params.Quantidade > 1 {
+			return Auction{}, fmt.Errorf("penny auctions sell a single unit")
+		}
+	} else if params.Penny != nil {
+		return Auction{}, fmt.Errorf("penny settings are only valid for penny auctions")
+	}
+
+	if params.Quantidade < 0 {
+		return Auction{}, fmt.Errorf("quantity cannot be negative")
+	}
+	quantidade := max(params.Quantidade, 1)
+	if tipo == models.AuctionDutch && quantidade > 1 {
+		return Auction{}, fmt.Errorf("dutch auctions sell a single unit")
+	}
+
+	if params.BuyNowPrice.IsNegative() || params.BuyNowThreshold.IsNegative() {
+		return Auction{}, fmt.Errorf("buy now settings cannot be negative")
+	}
+	if params.BuyNowPrice.IsPositive() {
+		if tipo != models.AuctionEnglish || quantidade > 1 {
+			return Auction{}, fmt.Errorf("buy now is only available for single-unit english auctions")
+		}
+		if !params.BuyNowPrice.GreaterThan(params.StartingPrice) || params.BuyNowPrice.LessThan(params.ReservePrice) {
+			return Auction{}, fmt.Errorf("buy now price must be above the starting price and cover the reserve")
+		}
+		if !params.BuyNowThreshold.LessThan(params.BuyNowPrice) {
+			return Auction{}, fmt.Errorf("buy now threshold must be below the buy now price")
+		}
+	} else if params.BuyNowThreshold.IsPositive() {
+		return Auction{}, fmt.Errorf("buy now threshold requires a buy now price")
+	}
+
+	if params.MaxBidsPerUser < 0 {
+		return Auction{}, fmt.Errorf("max bids per user cannot be negative")
+	}
+
+	increments := params.Increments
+	if len(increments) == 0 {
+		increments = models.DefaultIncrements
+	}
+	if err := increments.Validate(); err != nil {
+		return Auction{}, err
 	}
 
 	l.mu.Lock()
 
 	newAuction := Auction{
-		ID:        strconv.Itoa(len(l.auctions) + 1),
-		Descricao: desc,
-		Inicio:    start,
-		Fim:       end,
-		Ativo:     false,
+		ID:            models.NewAuctionID(),
+		Descricao:     params.Descricao,
+		Inicio:        params.Inicio,
+		Fim:           params.Fim,
+		Estado:        StateScheduled,
+		ReservePrice:  params.ReservePrice,
+		StartingPrice: params.StartingPrice,
+		Increments:    increments,
+
+		SoftCloseWindow:    params.SoftCloseWindow,
+		SoftCloseExtension: params.SoftCloseExtension,
+
+		Tipo:  tipo,
+		Dutch: params.Dutch,
+
+		Quantidade:   quantidade,
+		CeilingPrice: params.CeilingPrice,
+
+		Penny: params.Penny,
+
+		BuyNowPrice:     params.BuyNowPrice,
+		BuyNowThreshold: params.BuyNowThreshold,
+
+		SellerID:       params.SellerID,
+		MaxBidsPerUser: params.MaxBidsPerUser,
 	}
 
-	l.auctions = append(l.auctions, newAuction)
-	pAuction := &l.auctions[len(l.auctions)-1]
+	if err := l.repo.Save(newAuction); err != nil {
+		l.mu.Unlock()
+		return Auction{}, fmt.Errorf("failed to save auction: %w", err)
+	}
 	l.mu.Unlock()
 
-	l.ScheduleAuction(pAuction)
+	l.ScheduleAuction(newAuction)
 
 	log.Printf("Leilão criado e agendado: %s (%s) - Início: %s, Fim: %s",
 		newAuction.ID, newAuction.Descricao,
 		newAuction.Inicio.Format(time.RFC3339),
 		newAuction.Fim.Format(time.RFC3339))
 
-	return nil
+	return newAuction, nil
 }
 
 func (l *MsLeilao) ConsultAuctions() []Auction {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
+	auctions, err := l.repo.List()
+	if err != nil {
+		log.Printf("Erro ao listar leilões: %v", err)
+		return []Auction{}
+	}
 
-	auctions := make([]Auction, len(l.auctions))
-	copy(auctions, l.auctions)
+	for i := range auctions {
+		auctions[i].ReservePrice = money.Money{}
+	}
 	return auctions
 }
 
+// Start recarrega os leilões que ainda não terminaram. Leilões cujo início ou
+// fim passou enquanto o serviço estava fora ficam agendados para o passado, e o
+// scheduler dispara os eventos perdidos assim que começa a rodar
 func (l *MsLeilao) Start() {
-	rabbitmq.DeclareExchange(l.ch, "leilao_events", "topic")
+	l.DeclareExchangeAndQueues()
+	l.ListenLeilaoVencedor()
+	l.ListenReservaNaoAtingida()
+	l.ListenLanceValidado()
+	l.ListenLeilaoProrrogado()
+	l.ListenStatusPagamento()
+	l.ListenRepassePendente()
 
-	l.mu.RLock()
-	for i := range l.auctions {
-		l.ScheduleAuction(&l.auctions[i])
+	auctions, err := l.repo.List()
+	if err != nil {
+		log.Printf("Erro ao carregar leilões: %v", err)
+		return
 	}
-	l.mu.RUnlock()
+
+	now := l.clock.Now()
+	for _, a := range auctions {
+		if !a.Estado.Open() {
+			continue
+		}
+
+		if a.Estado == StateScheduled && !now.Before(a.Inicio) {
+			log.Printf("Leilão %s deveria ter iniciado em %s, reconciliando", a.ID, a.Inicio.Format(time.RFC3339))
+		}
+		if !now.Before(a.Fim) {
+			log.Printf("Leilão %s deveria ter finalizado em %s, reconciliando", a.ID, a.Fim.Format(time.RFC3339))
+		}
+
+		l.ScheduleAuction(a)
+	}
+
+	go l.scheduler.Run()
 
 	fmt.Println("Agendamento de leilões iniciado.")
 }
 
-func (l *MsLeilao) ScheduleAuction(auction *Auction) {
-	go func(a *Auction) {
-		time.Sleep(time.Until(a.Inicio))
-		a.Ativo = true
-		event := models.LeilaoIniciado{
-			ID:         a.ID,
-			Descricao:  a.Descricao,
-			DataInicio: a.Inicio,
-			DataFim:    a.Fim,
+func (l *MsLeilao) ScheduleAuction(auction Auction) {
+	if auction.Estado == StateScheduled {
+		l.scheduler.Schedule(auction.ID, EventStart, auction.Inicio)
+	}
+	if auction.Estado == StateActive && auction.Dutch != nil && auction.PrecoAtual.GreaterThan(auction.Dutch.FloorPrice) {
+		l.scheduler.Schedule(auction.ID, EventPriceTick, auction.ProximaQueda)
+	}
+	l.scheduler.Schedule(auction.ID, EventEnd, auction.Fim)
+}
+
+// UpdateAuction altera um leilão respeitando o estado em que ele está: antes
+// de iniciar tudo pode mudar, durante o leilão só a descrição e o fim, e
+// depois de finalizado ou cancelado nada
+func (l *MsLeilao) UpdateAuction(id string, upd AuctionUpdate) (Auction, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(id)
+	if err != nil {
+		return Auction{}, err
+	}
+	if !a.Estado.Open() {
+		return Auction{}, ErrAuctionClosed
+	}
+
+	now := l.clock.Now()
+
+	if upd.Descricao != nil {
+		if strings.TrimSpace(*upd.Descricao) == "" {
+			return Auction{}, fmt.Errorf("description cannot be empty")
+		}
+		a.Descricao = *upd.Descricao
+	}
+
+	if upd.Inicio != nil {
+		if a.Estado == StateActive {
+			return Auction{}, fmt.Errorf("start time cannot be changed after the auction started")
+		}
+		if upd.Inicio.Before(now) {
+			return Auction{}, fmt.Errorf("start time cannot be in the past")
+		}
+		a.Inicio = *upd.Inicio
+	}
+
+	if upd.Fim != nil {
+		if upd.Fim.Before(now) {
+			return Auction{}, fmt.Errorf("end time cannot be in the past")
+		}
+		a.Fim = *upd.Fim
+	}
+
+	if a.Fim.Before(a.Inicio) {
+		return Auction{}, fmt.Errorf("end time cannot be before start time")
+	}
+
+	if err := l.repo.Save(a); err != nil {
+		return Auction{}, fmt.Errorf("failed to save auction: %w", err)
+	}
+
+	l.ScheduleAuction(a)
+
+	event := models.LeilaoAtualizado{
+		ID:         a.ID,
+		Descricao:  a.Descricao,
+		DataInicio: a.Inicio,
+		DataFim:    a.Fim,
+	}
+	body, _ := json.Marshal(event)
+	l.pub.Publish("leilao.atualizado", body)
+
+	log.Printf("Leilão %s atualizado - Início: %s, Fim: %s", a.ID,
+		a.Inicio.Format(time.RFC3339), a.Fim.Format(time.RFC3339))
+
+	return a, nil
+}
+
+// CancelAuction retira um leilão agendado ou em andamento
+func (l *MsLeilao) CancelAuction(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(id)
+	if err != nil {
+		return err
+	}
+	if !a.Estado.Open() {
+		return ErrAuctionClosed
+	}
+
+	if err := l.transition(&a, StateCancelled); err != nil {
+		return err
+	}
+
+	l.scheduler.Cancel(a.ID)
+
+	event := models.LeilaoCancelado{
+		ID:        a.ID,
+		Descricao: a.Descricao,
+	}
+	body, _ := json.Marshal(event)
+	l.pub.Publish("leilao.cancelado", body)
+
+	log.Printf("Leilão %s cancelado!", a.ID)
+
+	return nil
+}
+
+// FastForward antecipa o início ou o fim de um leilão para agora. É usado
+// apenas pelo endpoint de admin de desenvolvimento
+func (l *MsLeilao) FastForward(id string, to EventKind) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(id)
+	if err != nil {
+		return err
+	}
+	if !a.Estado.Open() {
+		return ErrAuctionClosed
+	}
+
+	now := l.clock.Now()
+	switch to {
+	case EventStart:
+		if a.Estado == StateActive {
+			return fmt.Errorf("auction %s already started", id)
+		}
+		a.Inicio = now
+	case EventEnd:
+		if a.Estado == StateScheduled {
+			a.Inicio = now
+		}
+		a.Fim = now
+	default:
+		return fmt.Errorf("invalid event %s", to)
+	}
+
+	if err := l.repo.Save(a); err != nil {
+		return fmt.Errorf("failed to save auction: %w", err)
+	}
+
+	l.ScheduleAuction(a)
+	log.Printf("Leilão %s adiantado para o %s", a.ID, to)
+
+	return nil
+}
+
+func (l *MsLeilao) handleScheduledEvent(auctionID string, kind EventKind) {
+	switch kind {
+	case EventStart:
+		l.startAuction(auctionID)
+	case EventEnd:
+		l.finishAuction(auctionID)
+	case EventPriceTick:
+		l.dropPrice(auctionID)
+	}
+}
+
+func (l *MsLeilao) startAuction(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(id)
+	if err != nil {
+		log.Printf("Erro ao iniciar leilão %s: %v", id, err)
+		return
+	}
+	if a.Estado != StateScheduled {
+		return
+	}
+
+	if a.Dutch != nil {
+		a.PrecoAtual = a.Dutch.StartPrice
+		a.ProximaQueda = l.clock.Now().Add(time.Duration(a.Dutch.Interval) * time.Second)
+	}
+
+	if err := l.transition(&a, StateActive); err != nil {
+		log.Printf("Erro ao iniciar leilão %s: %v", id, err)
+		return
+	}
+
+	if a.Dutch != nil {
+		l.scheduler.Schedule(a.ID, EventPriceTick, a.ProximaQueda)
+	}
+
+	body, _ := json.Marshal(a.leilaoIniciado())
+
+	l.pub.Publish("leilao.iniciado", body)
+	log.Printf("Leilão %s iniciado!", a.ID)
+}
+
+// leilaoIniciado monta o evento com tudo que o mslance precisa para validar
+// lances, inclusive a reserva
+func (a Auction) leilaoIniciado() models.LeilaoIniciado {
+	return models.LeilaoIniciado{
+		ID:            a.ID,
+		Descricao:     a.Descricao,
+		DataInicio:    a.Inicio,
+		DataFim:       a.Fim,
+		ReservePrice:  a.ReservePrice,
+		StartingPrice: a.StartingPrice,
+		Increments:    a.Increments,
+		Tipo:          a.Tipo,
+		Dutch:         a.Dutch,
+		Quantidade:    a.Quantidade,
+		CeilingPrice:  a.CeilingPrice,
+		Penny:         a.Penny,
+
+		BuyNowPrice:     a.BuyNowPrice,
+		BuyNowThreshold: a.BuyNowThreshold,
+
+		SellerID:       a.SellerID,
+		MaxBidsPerUser: a.MaxBidsPerUser,
+
+		SoftCloseWindow:    a.SoftCloseWindow,
+		SoftCloseExtension: a.SoftCloseExtension,
+	}
+}
+
+// OpenAuctions lista os leilões que ainda dependem do mslance: os ativos e os
+// finalizados que aguardam o vencedor. Inclui a reserva, então só pode sair
+// pela rota interna usada na recuperação do mslance
+func (l *MsLeilao) OpenAuctions() ([]models.LeilaoAberto, error) {
+	auctions, err := l.repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	abertos := []models.LeilaoAberto{}
+	for _, a := range auctions {
+		if a.Estado != StateActive && a.Estado != StateClosed {
+			continue
 		}
-		body, _ := json.Marshal(event)
+		abertos = append(abertos, models.LeilaoAberto{
+			LeilaoIniciado: a.leilaoIniciado(),
+			Encerrado:      a.Estado == StateClosed,
+			PrecoAtual:     a.PrecoAtual,
+		})
+	}
+	return abertos, nil
+}
 
-		rabbitmq.PublishToExchange(l.ch, "leilao_events", "leilao.iniciado", body)
-		log.Printf("Leilão %s iniciado!", a.ID)
-	}(auction)
+func (l *MsLeilao) finishAuction(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(id)
+	if err != nil {
+		log.Printf("Erro ao finalizar leilão %s: %v", id, err)
+		return
+	}
+	if a.Estado != StateActive {
+		return
+	}
+	// o timer já tinha disparado quando um leilao.prorrogado mudou o fim
+	if l.clock.Now().Before(a.Fim) {
+		return
+	}
 
-	go func(a *Auction) {
-		time.Sleep(time.Until(a.Fim))
-		a.Ativo = false
-		event := map[string]string{
-			"id":          a.ID,
-			"description": a.Descricao,
+	if err := l.closeAuction(&a); err != nil {
+		log.Printf("Erro ao finalizar leilão %s: %v", id, err)
+	}
+}
+
+// closeAuction encerra um leilão ativo, seja pelo timer de fim ou por uma
+// vitória antecipada. Deve ser chamada com l.mu travado
+func (l *MsLeilao) closeAuction(a *Auction) error {
+	l.scheduler.Cancel(a.ID)
+
+	if err := l.transition(a, StateClosed); err != nil {
+		return err
+	}
+
+	event := models.LeilaoFinalizado{
+		ID:        a.ID,
+		Descricao: a.Descricao,
+		DataFim:   a.Fim,
+	}
+	body, _ := json.Marshal(event)
+	l.pub.Publish("leilao.finalizado", body)
+
+	log.Printf("Leilão %s finalizado!", a.ID)
+	return nil
+}
+
+// dropPrice baixa o preço do leilão holandês em um degrau, sem passar do piso,
+// e agenda a próxima queda enquanto ainda houver para onde cair
+func (l *MsLeilao) dropPrice(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(id)
+	if err != nil {
+		log.Printf("Erro ao baixar preço do leilão %s: %v", id, err)
+		return
+	}
+	if a.Estado != StateActive || a.Dutch == nil {
+		return
+	}
+
+	preco, err := a.PrecoAtual.Sub(a.Dutch.Step)
+	if err != nil {
+		log.Printf("Erro ao baixar preço do leilão %s: %v", id, err)
+		return
+	}
+	a.PrecoAtual = money.Max(a.Dutch.FloorPrice, preco)
+	a.ProximaQueda = l.clock.Now().Add(time.Duration(a.Dutch.Interval) * time.Second)
+	if err := l.repo.Save(a); err != nil {
+		log.Printf("Erro ao salvar leilão %s: %v", id, err)
+		return
+	}
+
+	if a.PrecoAtual.GreaterThan(a.Dutch.FloorPrice) {
+		l.scheduler.Schedule(a.ID, EventPriceTick, a.ProximaQueda)
+	}
+
+	event := models.LeilaoPrecoAtualizado{
+		ID:    a.ID,
+		Preco: a.PrecoAtual,
+	}
+	body, _ := json.Marshal(event)
+	l.pub.Publish("leilao.preco_atualizado", body)
+
+	log.Printf("Leilão %s agora custa %s", a.ID, a.PrecoAtual)
+}
+
+// transition muda o estado do leilão, persiste e publica leilao.estado_alterado.
+// Deve ser chamada com l.mu travado
+func (l *MsLeilao) transition(a *Auction, to State) error {
+	from := a.Estado
+	if !from.CanTransitionTo(to) {
+		return &ErrInvalidTransition{From: from, To: to}
+	}
+
+	a.Estado = to
+	if err := l.repo.Save(*a); err != nil {
+		a.Estado = from
+		return fmt.Errorf("failed to save auction: %w", err)
+	}
+
+	event := models.LeilaoEstadoAlterado{
+		ID:             a.ID,
+		EstadoAnterior: string(from),
+		Estado:         string(to),
+		Timestamp:      l.clock.Now(),
+	}
+	body, _ := json.Marshal(event)
+	l.pub.Publish("leilao.estado_alterado", body)
+
+	log.Printf("Leilão %s: %s -> %s", a.ID, from, to)
+	return nil
+}
+
+// Inicializa a exchange e faz o binding das filas
+func (l *MsLeilao) DeclareExchangeAndQueues() {
+	rabbitmq.DeclareExchange(l.ch, "leilao_events", "topic")
+
+	rabbitmq.DeclareQueue(l.ch, "msleilao_leilao_vencedor")
+	rabbitmq.BindQueueToExchange(l.ch, "msleilao_leilao_vencedor", "leilao.vencedor", "leilao_events")
+
+	rabbitmq.DeclareQueue(l.ch, "msleilao_reserva_nao_atingida")
+	rabbitmq.BindQueueToExchange(l.ch, "msleilao_reserva_nao_atingida", "leilao.reserva_nao_atingida", "leilao_events")
+
+	rabbitmq.DeclareQueue(l.ch, "msleilao_lance_validado")
+	rabbitmq.BindQueueToExchange(l.ch, "msleilao_lance_validado", "lance.validado", "leilao_events")
+
+	rabbitmq.DeclareQueue(l.ch, "msleilao_leilao_prorrogado")
+	rabbitmq.BindQueueToExchange(l.ch, "msleilao_leilao_prorrogado", "leilao.prorrogado", "leilao_events")
+
+	rabbitmq.DeclareQueue(l.ch, "msleilao_status_pagamento")
+	rabbitmq.BindQueueToExchange(l.ch, "msleilao_status_pagamento", "status.pagamento", "leilao_events")
+
+	rabbitmq.DeclareQueue(l.ch, "msleilao_repasse_pendente")
+	rabbitmq.BindQueueToExchange(l.ch, "msleilao_repasse_pendente", "repasse.pendente", "leilao_events")
+}
+
+func (l *MsLeilao) ListenLeilaoVencedor() {
+	msgs, _ := l.ch.Consume("msleilao_leilao_vencedor", "", true, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var vencedor models.LeilaoVencedor
+			if err := json.Unmarshal(d.Body, &vencedor); err != nil {
+				log.Println("Error decoding leilao_vencedor:", err)
+				continue
+			}
+
+			l.settleWinner(vencedor)
 		}
-		body, _ := json.Marshal(event)
-		rabbitmq.PublishToExchange(l.ch, "leilao_events", "leilao.finalizado", body)
+	}()
+}
+
+func (l *MsLeilao) ListenReservaNaoAtingida() {
+	msgs, _ := l.ch.Consume("msleilao_reserva_nao_atingida", "", true, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var reserva models.LeilaoReservaNaoAtingida
+			if err := json.Unmarshal(d.Body, &reserva); err != nil {
+				log.Println("Error decoding leilao_reserva_nao_atingida:", err)
+				continue
+			}
 
-		log.Printf("Leilão %s finalizado!", a.ID)
-	}(auction)
+			l.advance(reserva.LeilaoID, StateClosed, StateUnsold)
+		}
+	}()
+}
+
+func (l *MsLeilao) ListenLanceValidado() {
+	msgs, _ := l.ch.Consume("msleilao_lance_validado", "", true, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var lance models.LanceValidado
+			if err := json.Unmarshal(d.Body, &lance); err != nil {
+				log.Println("Error decoding lance_validado:", err)
+				continue
+			}
+
+			l.withdrawBuyNow(lance)
+		}
+	}()
+}
+
+// withdrawBuyNow retira a compra imediata quando os lances passam do limite
+// configurado. O mslance faz a mesma conta; aqui é só para que a listagem
+// pare de oferecer a opção
+func (l *MsLeilao) withdrawBuyNow(lance models.LanceValidado) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(lance.LeilaoID)
+	if err != nil {
+		log.Printf("Erro ao atualizar leilão %s: %v", lance.LeilaoID, err)
+		return
+	}
+	if a.Estado != StateActive || a.BuyNowPrice.IsZero() || lance.Valor.LessThan(a.BuyNowThreshold) {
+		return
+	}
+
+	a.BuyNowPrice = money.Money{}
+	if err := l.repo.Save(a); err != nil {
+		log.Printf("Erro ao salvar leilão %s: %v", a.ID, err)
+		return
+	}
+
+	log.Printf("Compra imediata retirada do leilão %s", a.ID)
+}
+
+func (l *MsLeilao) ListenLeilaoProrrogado() {
+	msgs, _ := l.ch.Consume("msleilao_leilao_prorrogado", "", true, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var prorrogado models.LeilaoProrrogado
+			if err := json.Unmarshal(d.Body, &prorrogado); err != nil {
+				log.Println("Error decoding leilao_prorrogado:", err)
+				continue
+			}
+
+			l.extendAuction(prorrogado)
+		}
+	}()
+}
+
+// extendAuction reagenda o término de um leilão que o mslance prorrogou (soft
+// close ou leilão de centavos). O mslance decide a prorrogação ao aceitar o
+// lance, antes do fim, mas o evento pode chegar aqui depois que o timer antigo
+// já encerrou o leilão; nesse caso o leilão é reaberto, já que o mslance
+// ignora o leilao.finalizado com o fim antigo e ainda não publicou resultado
+func (l *MsLeilao) extendAuction(prorrogado models.LeilaoProrrogado) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(prorrogado.ID)
+	if err != nil {
+		log.Printf("Erro ao prorrogar leilão %s: %v", prorrogado.ID, err)
+		return
+	}
+	if !prorrogado.DataFim.After(a.Fim) {
+		return
+	}
+
+	a.Fim = prorrogado.DataFim
+	switch a.Estado {
+	case StateActive:
+		if err := l.repo.Save(a); err != nil {
+			log.Printf("Erro ao salvar leilão %s: %v", a.ID, err)
+			return
+		}
+	case StateClosed:
+		if err := l.transition(&a, StateActive); err != nil {
+			log.Printf("Erro ao reabrir leilão %s: %v", a.ID, err)
+			return
+		}
+		log.Printf("Leilão %s reaberto: o lance que o prorrogou chegou antes do fim", a.ID)
+	default:
+		return
+	}
+
+	l.scheduler.Schedule(a.ID, EventEnd, a.Fim)
+	log.Printf("Leilão %s prorrogado até %s", a.ID, a.Fim.Format(time.RFC3339))
+}
+
+func (l *MsLeilao) ListenStatusPagamento() {
+	msgs, _ := l.ch.Consume("msleilao_status_pagamento", "", true, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var status models.StatusPagamento
+			if err := json.Unmarshal(d.Body, &status); err != nil {
+				log.Println("Error decoding status_pagamento:", err)
+				continue
+			}
+
+			l.settlePayment(status)
+		}
+	}()
+}
+
+// ListenRepassePendente quita os leilões reversos. O repasse ao fornecedor é
+// feito fora da plataforma; para o leilão basta que ele tenha sido registrado
+func (l *MsLeilao) ListenRepassePendente() {
+	msgs, _ := l.ch.Consume("msleilao_repasse_pendente", "", true, false, false, false, nil)
+	go func() {
+		for d := range msgs {
+			var repasse models.RepassePendente
+			if err := json.Unmarshal(d.Body, &repasse); err != nil {
+				log.Println("Error decoding repasse_pendente:", err)
+				continue
+			}
+
+			l.settlePayment(models.StatusPagamento{
+				TransactionID: repasse.ID,
+				Status:        "approved",
+				AuctionID:     repasse.LeilaoID,
+				WinnerID:      repasse.SupplierID,
+				Amount:        repasse.Amount,
+			})
+		}
+	}()
+}
+
+// settleWinner leva o leilão para aguardando pagamento, ou não vendido se
+// ninguém deu lance. No holandês o vencedor chega com o leilão ainda ativo,
+// então ele é encerrado aqui mesmo e o timer de fim é descartado. Leilões de
+// várias unidades recebem um leilao.vencedor por vencedor; só o primeiro muda
+// o estado
+func (l *MsLeilao) settleWinner(vencedor models.LeilaoVencedor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(vencedor.LeilaoID)
+	if err != nil {
+		log.Printf("Erro ao atualizar leilão %s: %v", vencedor.LeilaoID, err)
+		return
+	}
+
+	if a.Estado == StateActive {
+		if err := l.closeAuction(&a); err != nil {
+			log.Printf("Erro ao finalizar leilão %s: %v", a.ID, err)
+			return
+		}
+	}
+
+	if a.Estado == StateAwaitingPayment && vencedor.Vencedores > 1 {
+		return
+	}
+
+	if a.Estado != StateClosed {
+		log.Printf("Leilão %s está em %s, ignorando vencedor", a.ID, a.Estado)
+		return
+	}
+
+	to := StateAwaitingPayment
+	if vencedor.UserID == "" {
+		to = StateUnsold
+	} else {
+		a.PagamentosPendentes = max(vencedor.Vencedores, 1)
+	}
+	if err := l.transition(&a, to); err != nil {
+		log.Printf("Erro ao atualizar leilão %s: %v", a.ID, err)
+	}
+}
+
+// settlePayment conta os pagamentos de um leilão aguardando pagamento. Quando
+// o último chega, o leilão fica quitado se ao menos um vencedor pagou, ou não
+// vendido se todos foram recusados
+func (l *MsLeilao) settlePayment(status models.StatusPagamento) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(status.AuctionID)
+	if err != nil {
+		log.Printf("Erro ao atualizar leilão %s: %v", status.AuctionID, err)
+		return
+	}
+	if a.Estado != StateAwaitingPayment {
+		log.Printf("Leilão %s está em %s, ignorando pagamento", a.ID, a.Estado)
+		return
+	}
+
+	if status.Status == "approved" {
+		a.PagamentosAprovados++
+	}
+	a.PagamentosPendentes = max(a.PagamentosPendentes, 1) - 1
+
+	if a.PagamentosPendentes > 0 {
+		if err := l.repo.Save(a); err != nil {
+			log.Printf("Erro ao salvar leilão %s: %v", a.ID, err)
+		}
+		return
+	}
+
+	to := StateSettled
+	if a.PagamentosAprovados == 0 {
+		to = StateUnsold
+	}
+	if err := l.transition(&a, to); err != nil {
+		log.Printf("Erro ao atualizar leilão %s: %v", a.ID, err)
+	}
+}
+
+// advance aplica uma transição disparada por evento externo, ignorando
+// eventos que chegam quando o leilão não está mais no estado esperado
+func (l *MsLeilao) advance(id string, from State, to State) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, err := l.repo.Get(id)
+	if err != nil {
+		log.Printf("Erro ao atualizar leilão %s: %v", id, err)
+		return
+	}
+	if a.Estado != from {
+		log.Printf("Leilão %s está em %s, ignorando transição para %s", id, a.Estado, to)
+		return
+	}
+
+	if err := l.transition(&a, to); err != nil {
+		log.Printf("Erro ao atualizar leilão %s: %v", id, err)
+	}
 }
@@ -0,0 +1,424 @@
+package msleilao
+
+import (
+	"auction-system/pkg/clock"
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type publicacao struct {
+	key  string
+	body []byte
+}
+
+type recordingPublisher struct {
+	mu  sync.Mutex
+	msg []publicacao
+}
+
+func (p *recordingPublisher) Publish(key string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msg = append(p.msg, publicacao{key, body})
+	return nil
+}
+
+// take devolve e esquece as publicações com a routing key dada
+func (p *recordingPublisher) take(key string) [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var bodies [][]byte
+	rest := p.msg[:0]
+	for _, m := range p.msg {
+		if m.key == key {
+			bodies = append(bodies, m.body)
+		} else {
+			rest = append(rest, m)
+		}
+	}
+	p.msg = rest
+	return bodies
+}
+
+type memRepo struct {
+	mu       sync.Mutex
+	auctions map[string]Auction
+	order    []string
+}
+
+func (r *memRepo) Save(a Auction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.auctions[a.ID]; !ok {
+		r.order = append(r.order, a.ID)
+	}
+	r.auctions[a.ID] = a
+	return nil
+}
+
+func (r *memRepo) Get(id string) (Auction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.auctions[id]
+	if !ok {
+		return Auction{}, ErrAuctionNotFound
+	}
+	return a, nil
+}
+
+func (r *memRepo) List() ([]Auction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var list []Auction
+	for _, id := range r.order {
+		list = append(list, r.auctions[id])
+	}
+	return list, nil
+}
+
+type leilaoHarness struct {
+	*MsLeilao
+	clk   *clock.Fake
+	pub   *recordingPublisher
+	fired chan firedEvent
+}
+
+// newHarness monta um MsLeilao com relógio falso, repositório em memória e sem
+// RabbitMQ. O scheduler avisa em fired depois de tratar cada evento
+func newHarness(t *testing.T) *leilaoHarness {
+	t.Helper()
+
+	h := &leilaoHarness{
+		clk:   clock.NewFake(t0),
+		pub:   &recordingPublisher{},
+		fired: make(chan firedEvent, 64),
+	}
+	h.MsLeilao = newMsLeilao(h.pub, &memRepo{auctions: make(map[string]Auction)}, h.clk)
+	h.scheduler = NewScheduler(h.clk, func(id string, kind EventKind) {
+		h.handleScheduledEvent(id, kind)
+		h.fired <- firedEvent{id, kind}
+	})
+	go h.scheduler.Run()
+	t.Cleanup(h.scheduler.Stop)
+	return h
+}
+
+func (h *leilaoHarness) advance(t *testing.T, d time.Duration) []firedEvent {
+	t.Helper()
+	h.clk.Advance(d)
+	return settle(t, h.scheduler, h.clk, h.fired)
+}
+
+func (h *leilaoHarness) create(t *testing.T, params AuctionParams) Auction {
+	t.Helper()
+
+	if params.Descricao == "" {
+		params.Descricao = "lote"
+	}
+	a, err := h.CreateAuction(params)
+	if err != nil {
+		t.Fatalf("CreateAuction: %v", err)
+	}
+	return a
+}
+
+func (h *leilaoHarness) state(t *testing.T, id string) State {
+	t.Helper()
+	a, err := h.repo.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.Estado
+}
+
+func TestAuctionLifecycle(t *testing.T) {
+	h := newHarness(t)
+	a := h.create(t, AuctionParams{Inicio: t0.Add(time.Minute), Fim: t0.Add(3 * time.Minute)})
+
+	if s := h.state(t, a.ID); s != StateScheduled {
+		t.Fatalf("state = %s before start, want scheduled", s)
+	}
+
+	h.advance(t, time.Minute)
+	if s := h.state(t, a.ID); s != StateActive {
+		t.Fatalf("state = %s after start, want active", s)
+	}
+	iniciados := h.pub.take("leilao.iniciado")
+	if len(iniciados) != 1 {
+		t.Fatalf("published %d leilao.iniciado, want 1", len(iniciados))
+	}
+	var iniciado models.LeilaoIniciado
+	json.Unmarshal(iniciados[0], &iniciado)
+	if iniciado.ID != a.ID || !iniciado.DataFim.Equal(a.Fim) {
+		t.Errorf("leilao.iniciado = %+v, want id %s ending at %s", iniciado, a.ID, a.Fim)
+	}
+
+	h.advance(t, 2*time.Minute)
+	if s := h.state(t, a.ID); s != StateClosed {
+		t.Fatalf("state = %s after end, want closed", s)
+	}
+	if n := len(h.pub.take("leilao.finalizado")); n != 1 {
+		t.Errorf("published %d leilao.finalizado, want 1", n)
+	}
+}
+
+func TestUpdateAuctionMovesEnd(t *testing.T) {
+	h := newHarness(t)
+	a := h.create(t, AuctionParams{Inicio: t0, Fim: t0.Add(time.Minute)})
+	h.advance(t, 0)
+
+	novoFim := t0.Add(10 * time.Minute)
+	if _, err := h.UpdateAuction(a.ID, AuctionUpdate{Fim: &novoFim}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(h.pub.take("leilao.atualizado")); n != 1 {
+		t.Errorf("published %d leilao.atualizado, want 1", n)
+	}
+
+	h.advance(t, time.Minute)
+	if s := h.state(t, a.ID); s != StateActive {
+		t.Fatalf("state = %s at the old end, want active", s)
+	}
+
+	h.advance(t, 9*time.Minute)
+	if s := h.state(t, a.ID); s != StateClosed {
+		t.Fatalf("state = %s at the new end, want closed", s)
+	}
+}
+
+func TestCancelAuctionDropsEvents(t *testing.T) {
+	h := newHarness(t)
+	a := h.create(t, AuctionParams{Inicio: t0.Add(time.Minute), Fim: t0.Add(2 * time.Minute)})
+
+	if err := h.CancelAuction(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.advance(t, time.Hour); len(got) != 0 {
+		t.Fatalf("fired %v for a cancelled auction", got)
+	}
+	if s := h.state(t, a.ID); s != StateCancelled {
+		t.Errorf("state = %s, want cancelled", s)
+	}
+	if err := h.CancelAuction(a.ID); err != ErrAuctionClosed {
+		t.Errorf("second CancelAuction = %v, want ErrAuctionClosed", err)
+	}
+}
+
+func TestFastForward(t *testing.T) {
+	h := newHarness(t)
+	a := h.create(t, AuctionParams{Inicio: t0.Add(time.Hour), Fim: t0.Add(2 * time.Hour)})
+
+	if err := h.FastForward(a.ID, EventEnd); err != nil {
+		t.Fatal(err)
+	}
+	h.advance(t, 0)
+
+	// o início também foi adiantado, então o leilão passa por active antes de fechar
+	if s := h.state(t, a.ID); s != StateClosed {
+		t.Fatalf("state = %s after fast-forwarding to the end, want closed", s)
+	}
+	if n := len(h.pub.take("leilao.iniciado")); n != 1 {
+		t.Errorf("published %d leilao.iniciado, want 1", n)
+	}
+}
+
+func TestDutchPriceDropsToFloor(t *testing.T) {
+	h := newHarness(t)
+	a := h.create(t, AuctionParams{
+		Inicio: t0,
+		Fim:    t0.Add(time.Hour),
+		Tipo:   models.AuctionDutch,
+		Dutch: &models.DutchParams{
+			StartPrice: money.New(1000),
+			FloorPrice: money.New(750),
+			Step:       money.New(100),
+			Interval:   60,
+		},
+	})
+	h.advance(t, 0)
+
+	var precos []string
+	for range 5 {
+		h.advance(t, time.Minute)
+		for _, body := range h.pub.take("leilao.preco_atualizado") {
+			var ev models.LeilaoPrecoAtualizado
+			json.Unmarshal(body, &ev)
+			precos = append(precos, ev.Preco.String())
+		}
+	}
+
+	want := []string{money.New(900).String(), money.New(800).String(), money.New(750).String()}
+	if len(precos) != len(want) {
+		t.Fatalf("prices = %v, want %v", precos, want)
+	}
+	for i := range want {
+		if precos[i] != want[i] {
+			t.Fatalf("prices = %v, want %v", precos, want)
+		}
+	}
+	if got, _ := h.repo.Get(a.ID); !got.PrecoAtual.Equal(money.New(750)) {
+		t.Errorf("PrecoAtual = %s, want the floor", got.PrecoAtual)
+	}
+}
+
+func TestCreateAuctionRejectsOtherCurrencies(t *testing.T) {
+	usd := money.Money{Amount: 10_00, Currency: "USD"}
+	casos := map[string]AuctionParams{
+		"starting price": {StartingPrice: usd},
+		"reserve price":  {ReservePrice: usd},
+		"buy now price":  {BuyNowPrice: usd},
+		"increment":      {Increments: models.IncrementTable{{Step: usd}}},
+		"dutch step": {Tipo: models.AuctionDutch, Dutch: &models.DutchParams{
+			StartPrice: money.New(100_00), FloorPrice: money.New(10_00), Step: usd, Interval: 60,
+		}},
+		"penny increment": {Tipo: models.AuctionPenny, Penny: &models.PennyParams{Increment: usd, Timer: 10}},
+	}
+
+	for nome, params := range casos {
+		t.Run(nome, func(t *testing.T) {
+			h := newHarness(t)
+			params.Descricao = "lote"
+			params.Inicio = t0.Add(time.Minute)
+			params.Fim = t0.Add(time.Hour)
+
+			_, err := h.CreateAuction(params)
+			if !errors.Is(err, money.ErrCurrencyMismatch) {
+				t.Fatalf("CreateAuction = %v, want ErrCurrencyMismatch", err)
+			}
+			if list, _ := h.repo.List(); len(list) != 0 {
+				t.Errorf("%d leilões gravados, want 0", len(list))
+			}
+		})
+	}
+}
+
+func TestExtendAuction(t *testing.T) {
+	h := newHarness(t)
+	a := h.create(t, AuctionParams{
+		Inicio:             t0,
+		Fim:                t0.Add(time.Hour),
+		SoftCloseWindow:    60,
+		SoftCloseExtension: 120,
+	})
+	h.advance(t, 0)
+
+	h.extendAuction(models.LeilaoProrrogado{ID: a.ID, DataFim: t0.Add(time.Hour + 2*time.Minute)})
+	// um leilao.prorrogado atrasado não encurta o leilão
+	h.extendAuction(models.LeilaoProrrogado{ID: a.ID, DataFim: t0.Add(time.Hour + time.Minute)})
+
+	h.advance(t, time.Hour)
+	if s := h.state(t, a.ID); s != StateActive {
+		t.Fatalf("state = %s at the old end, want active", s)
+	}
+	h.advance(t, 2*time.Minute)
+	if s := h.state(t, a.ID); s != StateClosed {
+		t.Fatalf("state = %s at the new end, want closed", s)
+	}
+
+	var finalizado models.LeilaoFinalizado
+	bodies := h.pub.take("leilao.finalizado")
+	if len(bodies) != 1 {
+		t.Fatalf("published %d leilao.finalizado, want 1", len(bodies))
+	}
+	json.Unmarshal(bodies[0], &finalizado)
+	if !finalizado.DataFim.Equal(t0.Add(time.Hour + 2*time.Minute)) {
+		t.Errorf("leilao.finalizado end = %s, want the extended one", finalizado.DataFim.Sub(t0))
+	}
+}
+
+// O mslance aceitou um lance antes do fim, mas o leilao.prorrogado chegou
+// depois que o timer já tinha encerrado o leilão aqui
+func TestExtendAuctionAfterTimer(t *testing.T) {
+	h := newHarness(t)
+	a := h.create(t, AuctionParams{
+		Inicio:             t0,
+		Fim:                t0.Add(time.Hour),
+		SoftCloseWindow:    60,
+		SoftCloseExtension: 120,
+	})
+	h.advance(t, time.Hour)
+	if s := h.state(t, a.ID); s != StateClosed {
+		t.Fatalf("state = %s at the end, want closed", s)
+	}
+
+	h.extendAuction(models.LeilaoProrrogado{ID: a.ID, DataFim: t0.Add(time.Hour + 2*time.Minute)})
+	if s := h.state(t, a.ID); s != StateActive {
+		t.Fatalf("state = %s after a late leilao.prorrogado, want active", s)
+	}
+
+	h.advance(t, 2*time.Minute)
+	if s := h.state(t, a.ID); s != StateClosed {
+		t.Fatalf("state = %s at the new end, want closed", s)
+	}
+	if n := len(h.pub.take("leilao.finalizado")); n != 2 {
+		t.Errorf("published %d leilao.finalizado, want one per end", n)
+	}
+}
+
+func TestCreateAuctionReturnsID(t *testing.T) {
+	h := newHarness(t)
+	a, err := h.CreateAuction(AuctionParams{Descricao: "lote", Inicio: t0, Fim: t0.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.ValidateAuctionID(a.ID); err != nil {
+		t.Fatalf("CreateAuction returned id %q: %v", a.ID, err)
+	}
+	if got, err := h.repo.Get(a.ID); err != nil || got.Estado != StateScheduled {
+		t.Errorf("Get(%s) = %+v, %v, want the scheduled auction", a.ID, got, err)
+	}
+}
+
+// TestReserveOutcome aplica ao leilão encerrado pelo timer cada resultado que
+// o mslance publica no fechamento
+func TestReserveOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		publica func(h *leilaoHarness, id string)
+		want    State
+	}{
+		{"reserve met", func(h *leilaoHarness, id string) {
+			h.settleWinner(models.LeilaoVencedor{LeilaoID: id, UserID: "A", Valor: money.New(2500), PrecoFinal: money.New(2500)})
+		}, StateAwaitingPayment},
+		{"reserve missed", func(h *leilaoHarness, id string) {
+			// o que ListenReservaNaoAtingida faz com leilao.reserva_nao_atingida
+			h.MsLeilao.advance(id, StateClosed, StateUnsold)
+		}, StateUnsold},
+		{"no bids", func(h *leilaoHarness, id string) {
+			h.settleWinner(models.LeilaoVencedor{LeilaoID: id})
+		}, StateUnsold},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			a := h.create(t, AuctionParams{Inicio: t0, Fim: t0.Add(time.Hour), ReservePrice: money.New(2000)})
+			h.advance(t, time.Hour)
+			if s := h.state(t, a.ID); s != StateClosed {
+				t.Fatalf("state = %s at the end, want closed", s)
+			}
+			h.pub.take("leilao.estado_alterado")
+
+			tt.publica(h, a.ID)
+			if s := h.state(t, a.ID); s != tt.want {
+				t.Fatalf("state = %s, want %s", s, tt.want)
+			}
+
+			bodies := h.pub.take("leilao.estado_alterado")
+			if len(bodies) != 1 {
+				t.Fatalf("published %d leilao.estado_alterado, want 1", len(bodies))
+			}
+			var event models.LeilaoEstadoAlterado
+			json.Unmarshal(bodies[0], &event)
+			if event.EstadoAnterior != string(StateClosed) || event.Estado != string(tt.want) {
+				t.Errorf("leilao.estado_alterado = %s -> %s, want closed -> %s", event.EstadoAnterior, event.Estado, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package msleilao
+
+import (
+	"auction-system/pkg/rabbitmq"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher publica os eventos do msleilao na exchange leilao_events
+type Publisher interface {
+	Publish(routingKey string, body []byte) error
+}
+
+type amqpPublisher struct {
+	ch *amqp.Channel
+}
+
+func (p amqpPublisher) Publish(routingKey string, body []byte) error {
+	return rabbitmq.PublishToExchange(p.ch, "leilao_events", routingKey, body)
+}
@@ -0,0 +1,200 @@
+package msleilao
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrAuctionNotFound = errors.New("auction not found")
+
+// AuctionRepository guarda os leilões do msleilao
+type AuctionRepository interface {
+	Save(auction Auction) error
+	Get(id string) (Auction, error)
+	List() ([]Auction, error)
+}
+
+// minCompactLines é o tamanho do log abaixo do qual nunca vale a pena compactar
+const minCompactLines = 1024
+
+// FileAuctionRepository mantém os leilões em memória e acrescenta o leilão
+// alterado a um arquivo JSON Lines a cada Save, então gravar custa o mesmo com
+// dez ou dez mil leilões no catálogo. Vale a última linha de cada leilão. O
+// arquivo é compactado para uma linha por leilão ao abrir e sempre que o log
+// passa do dobro do catálogo
+type FileAuctionRepository struct {
+	path     string
+	mu       sync.RWMutex
+	file     *os.File
+	auctions map[string]Auction
+	// order guarda os ids na ordem de criação, a ordem de List
+	order []string
+	// lines é quantas linhas o arquivo tem desde a última compactação
+	lines int
+}
+
+func NewFileAuctionRepository(path string) (*FileAuctionRepository, error) {
+	repo := &FileAuctionRepository{
+		path:     path,
+		auctions: make(map[string]Auction),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := repo.load(data); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	if err := repo.compact(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// load aceita o formato atual, uma linha por alteração, e o antigo, um array
+// JSON com o catálogo inteiro, que é convertido na primeira compactação
+func (r *FileAuctionRepository) load(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var auctions []Auction
+		if err := json.Unmarshal(trimmed, &auctions); err != nil {
+			return err
+		}
+		for _, a := range auctions {
+			r.put(a)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var a Auction
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			// uma linha cortada por um crash no meio da escrita é descartada
+			continue
+		}
+		r.put(a)
+	}
+	return scanner.Err()
+}
+
+func (r *FileAuctionRepository) put(auction Auction) {
+	if _, ok := r.auctions[auction.ID]; !ok {
+		r.order = append(r.order, auction.ID)
+	}
+	r.auctions[auction.ID] = auction
+}
+
+func (r *FileAuctionRepository) Save(auction Auction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line, err := json.Marshal(auction)
+	if err != nil {
+		return fmt.Errorf("failed to encode auction: %w", err)
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write auction: %w", err)
+	}
+	if err := r.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync auctions: %w", err)
+	}
+
+	r.put(auction)
+	r.lines++
+
+	if r.lines > max(2*len(r.auctions), minCompactLines) {
+		return r.compact()
+	}
+	return nil
+}
+
+func (r *FileAuctionRepository) Get(id string) (Auction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	a, ok := r.auctions[id]
+	if !ok {
+		return Auction{}, ErrAuctionNotFound
+	}
+	return a, nil
+}
+
+func (r *FileAuctionRepository) List() ([]Auction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	auctions := make([]Auction, 0, len(r.order))
+	for _, id := range r.order {
+		auctions = append(auctions, r.auctions[id])
+	}
+	return auctions, nil
+}
+
+func (r *FileAuctionRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// compact regrava o arquivo com uma linha por leilão em um arquivo temporário
+// renomeado no fim, assim um crash no meio da escrita nunca deixa o arquivo
+// corrompido. Deve ser chamada com r.mu travado
+func (r *FileAuctionRepository) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, id := range r.order {
+		if err := enc.Encode(r.auctions[id]); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to encode auctions: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write auctions: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync auctions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", r.path, err)
+	}
+
+	// se a reabertura falhar o descritor antigo continua valendo: as linhas vão
+	// para o arquivo substituído, mas o estado em memória segue certo
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", r.path, err)
+	}
+	if r.file != nil {
+		r.file.Close()
+	}
+	r.file = f
+	r.lines = len(r.order)
+	return nil
+}
@@ -0,0 +1,111 @@
+package msleilao
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	n := 0
+	for s := bufio.NewScanner(f); s.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestFileAuctionRepositoryReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auctions.jsonl")
+
+	repo, err := NewFileAuctionRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if err := repo.Save(Auction{ID: fmt.Sprintf("a%d", i), Descricao: "v1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Save(Auction{ID: "a1", Descricao: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	repo, err = NewFileAuctionRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	list, _ := repo.List()
+	if len(list) != 3 || list[0].ID != "a0" || list[1].ID != "a1" || list[2].ID != "a2" {
+		t.Fatalf("List() = %+v, want a0, a1, a2 in creation order", list)
+	}
+	if a, _ := repo.Get("a1"); a.Descricao != "v2" {
+		t.Errorf("Get(a1).Descricao = %q, want the last saved version", a.Descricao)
+	}
+	if n := countLines(t, path); n != 3 {
+		t.Errorf("file has %d lines after reopening, want one per auction", n)
+	}
+}
+
+func TestFileAuctionRepositoryCompactsLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auctions.jsonl")
+
+	repo, err := NewFileAuctionRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	// um leilão holandês baixando o preço muitas vezes não pode crescer o arquivo sem limite
+	for i := range 5 * minCompactLines {
+		if err := repo.Save(Auction{ID: "dutch", Descricao: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countLines(t, path); n > minCompactLines {
+		t.Errorf("file has %d lines, want at most %d", n, minCompactLines)
+	}
+	if a, _ := repo.Get("dutch"); a.Descricao != fmt.Sprint(5*minCompactLines-1) {
+		t.Errorf("Get(dutch).Descricao = %q, want the last save", a.Descricao)
+	}
+}
+
+func TestFileAuctionRepositoryReadsLegacyArray(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auctions.json")
+
+	legacy := []Auction{{ID: "a", Fim: time.Unix(100, 0).UTC()}, {ID: "b"}}
+	data, _ := json.MarshalIndent(legacy, "", "  ")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := NewFileAuctionRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	if a, err := repo.Get("a"); err != nil || !a.Fim.Equal(legacy[0].Fim) {
+		t.Errorf("Get(a) = %+v, %v, want the legacy auction", a, err)
+	}
+	if err := repo.Save(Auction{ID: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := countLines(t, path); n != 3 {
+		t.Errorf("file has %d lines, want the legacy file converted to one line per auction", n)
+	}
+}
@@ -0,0 +1,192 @@
+package msleilao
+
+import (
+	"auction-system/pkg/clock"
+	"container/heap"
+	"sync"
+	"time"
+)
+
+type EventKind int
+
+const (
+	EventStart EventKind = iota
+	EventEnd
+	EventPriceTick
+)
+
+var eventKinds = []EventKind{EventStart, EventEnd, EventPriceTick}
+
+func (k EventKind) String() string {
+	switch k {
+	case EventStart:
+		return "start"
+	case EventEnd:
+		return "end"
+	case EventPriceTick:
+		return "price tick"
+	default:
+		return "unknown"
+	}
+}
+
+type eventKey struct {
+	auctionID string
+	kind      EventKind
+}
+
+type scheduledEvent struct {
+	eventKey
+	at    time.Time
+	index int
+}
+
+// eventHeap é uma min-heap ordenada pelo horário do evento. Em caso de empate o
+// início vem antes do fim, para um leilão reconciliado nunca finalizar antes de iniciar
+type eventHeap []*scheduledEvent
+
+func (h eventHeap) Len() int { return len(h) }
+
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].kind < h[j].kind
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h eventHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *eventHeap) Push(x any) {
+	e := x.(*scheduledEvent)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *eventHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// Scheduler dispara os eventos de todos os leilões a partir de uma única
+// goroutine e um único timer, sempre armado para o próximo evento da heap.
+// Os handlers rodam em série nessa goroutine, então é ela quem serializa as
+// mudanças de estado dos leilões
+type Scheduler struct {
+	clock   clock.Clock
+	mu      sync.Mutex
+	events  eventHeap
+	byKey   map[eventKey]*scheduledEvent
+	handler func(auctionID string, kind EventKind)
+	wake    chan struct{}
+	stop    chan struct{}
+}
+
+func NewScheduler(clk clock.Clock, handler func(auctionID string, kind EventKind)) *Scheduler {
+	return &Scheduler{
+		clock:   clk,
+		byKey:   make(map[eventKey]*scheduledEvent),
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Schedule agenda o evento do leilão para at, ou move o horário se ele já
+// estava agendado
+func (s *Scheduler) Schedule(auctionID string, kind EventKind, at time.Time) {
+	s.mu.Lock()
+	key := eventKey{auctionID: auctionID, kind: kind}
+	if e, ok := s.byKey[key]; ok {
+		e.at = at
+		heap.Fix(&s.events, e.index)
+	} else {
+		e := &scheduledEvent{eventKey: key, at: at}
+		heap.Push(&s.events, e)
+		s.byKey[key] = e
+	}
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+// Cancel remove todos os eventos pendentes do leilão
+func (s *Scheduler) Cancel(auctionID string) {
+	s.mu.Lock()
+	for _, kind := range eventKinds {
+		s.remove(eventKey{auctionID: auctionID, kind: kind})
+	}
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+// Pending é quantos eventos ainda estão na heap
+func (s *Scheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func (s *Scheduler) Run() {
+	timer := s.clock.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		if len(s.events) > 0 && !s.clock.Now().Before(s.events[0].at) {
+			e := heap.Pop(&s.events).(*scheduledEvent)
+			delete(s.byKey, e.eventKey)
+			s.mu.Unlock()
+
+			s.handler(e.auctionID, e.kind)
+			continue
+		}
+
+		var timerC <-chan time.Time
+		if len(s.events) > 0 {
+			timer.Reset(s.events[0].at.Sub(s.clock.Now()))
+			timerC = timer.C()
+		}
+		s.mu.Unlock()
+
+		// um disparo atrasado do timer só faz o loop reavaliar a heap
+		select {
+		case <-timerC:
+		case <-s.wake:
+			timer.Stop()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stop encerra Run. Os eventos pendentes ficam na heap, sem disparar
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+func (s *Scheduler) remove(key eventKey) {
+	e, ok := s.byKey[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&s.events, e.index)
+	delete(s.byKey, key)
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
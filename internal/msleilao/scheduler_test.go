@@ -0,0 +1,126 @@
+package msleilao
+
+import (
+	"auction-system/pkg/clock"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type firedEvent struct {
+	auctionID string
+	kind      EventKind
+}
+
+// testScheduler roda um Scheduler com relógio falso e entrega cada evento
+// disparado no canal devolvido
+func testScheduler(t *testing.T) (*Scheduler, *clock.Fake, <-chan firedEvent) {
+	t.Helper()
+
+	clk := clock.NewFake(t0)
+	fired := make(chan firedEvent, 64)
+	s := NewScheduler(clk, func(id string, kind EventKind) {
+		fired <- firedEvent{id, kind}
+	})
+	go s.Run()
+	t.Cleanup(s.Stop)
+	return s, clk, fired
+}
+
+// settle espera o scheduler disparar tudo que já venceu. Ele agenda um evento
+// sentinela para agora, com o maior EventKind, que só dispara depois de todos
+// os eventos vencidos, e devolve o que veio antes dele
+func settle(t *testing.T, s *Scheduler, clk *clock.Fake, fired <-chan firedEvent) []firedEvent {
+	t.Helper()
+
+	s.Schedule("sentinel", EventPriceTick, clk.Now())
+
+	var got []firedEvent
+	for {
+		select {
+		case e := <-fired:
+			if e.auctionID == "sentinel" {
+				return got
+			}
+			got = append(got, e)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("scheduler did not fire the sentinel; fired so far: %v", got)
+		}
+	}
+}
+
+func TestSchedulerFiresInTimeOrder(t *testing.T) {
+	s, clk, fired := testScheduler(t)
+
+	s.Schedule("a", EventEnd, t0.Add(2*time.Minute))
+	s.Schedule("b", EventStart, t0.Add(time.Minute))
+	s.Schedule("a", EventStart, t0.Add(30*time.Second))
+
+	if got := settle(t, s, clk, fired); len(got) != 0 {
+		t.Fatalf("fired %v before any deadline", got)
+	}
+
+	clk.Advance(time.Minute)
+	got := settle(t, s, clk, fired)
+	want := []firedEvent{{"a", EventStart}, {"b", EventStart}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("after 1m fired %v, want %v", got, want)
+	}
+
+	clk.Advance(time.Minute)
+	if got := settle(t, s, clk, fired); len(got) != 1 || got[0] != (firedEvent{"a", EventEnd}) {
+		t.Fatalf("after 2m fired %v, want the end of a", got)
+	}
+	if n := s.Pending(); n != 0 {
+		t.Errorf("Pending() = %d, want 0", n)
+	}
+}
+
+func TestSchedulerStartsBeforeEndOnTie(t *testing.T) {
+	s, clk, fired := testScheduler(t)
+
+	// reconciliado depois de um restart: início e fim já passaram
+	s.Schedule("a", EventEnd, t0.Add(-time.Minute))
+	s.Schedule("a", EventStart, t0.Add(-time.Minute))
+
+	got := settle(t, s, clk, fired)
+	if len(got) != 2 || got[0].kind != EventStart || got[1].kind != EventEnd {
+		t.Fatalf("fired %v, want start then end", got)
+	}
+}
+
+func TestSchedulerReschedule(t *testing.T) {
+	s, clk, fired := testScheduler(t)
+
+	s.Schedule("a", EventEnd, t0.Add(time.Minute))
+	s.Schedule("a", EventEnd, t0.Add(5*time.Minute))
+	if n := s.Pending(); n != 1 {
+		t.Fatalf("Pending() = %d after rescheduling, want 1", n)
+	}
+
+	clk.Advance(time.Minute)
+	if got := settle(t, s, clk, fired); len(got) != 0 {
+		t.Fatalf("fired %v at the old deadline", got)
+	}
+
+	clk.Advance(4 * time.Minute)
+	if got := settle(t, s, clk, fired); len(got) != 1 {
+		t.Fatalf("fired %v at the new deadline, want the end of a", got)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s, clk, fired := testScheduler(t)
+
+	s.Schedule("a", EventStart, t0.Add(time.Minute))
+	s.Schedule("a", EventEnd, t0.Add(2*time.Minute))
+	s.Schedule("b", EventEnd, t0.Add(2*time.Minute))
+	s.Cancel("a")
+
+	clk.Advance(time.Hour)
+	got := settle(t, s, clk, fired)
+	if len(got) != 1 || got[0] != (firedEvent{"b", EventEnd}) {
+		t.Fatalf("fired %v, want only the end of b", got)
+	}
+}
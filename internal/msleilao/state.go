@@ -0,0 +1,94 @@
+package msleilao
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type State string
+
+const (
+	StateScheduled       State = "scheduled"
+	StateActive          State = "active"
+	StateClosed          State = "closed"
+	StateAwaitingPayment State = "awaiting_payment"
+	StateSettled         State = "settled"
+	StateCancelled       State = "cancelled"
+	StateUnsold          State = "unsold"
+)
+
+// transitions lista, para cada estado, os estados que podem vir em seguida.
+// Estados fora do mapa são finais. Closed volta a Active quando um lance aceito
+// antes do fim prorrogou o leilão depois que o timer já o tinha encerrado
+var transitions = map[State][]State{
+	StateScheduled:       {StateActive, StateCancelled},
+	StateActive:          {StateClosed, StateCancelled},
+	StateClosed:          {StateActive, StateAwaitingPayment, StateUnsold},
+	StateAwaitingPayment: {StateSettled, StateUnsold},
+}
+
+func (s State) CanTransitionTo(to State) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Open indica se o leilão ainda pode ser editado ou cancelado
+func (s State) Open() bool {
+	return s == StateScheduled || s == StateActive
+}
+
+type ErrInvalidTransition struct {
+	From State
+	To   State
+}
+
+func (e *ErrInvalidTransition) Error() string {
+	return fmt.Sprintf("invalid transition from %s to %s", e.From, e.To)
+}
+
+type auctionJSON Auction
+
+// MarshalJSON mantém o campo "active" para os clientes que ainda não leem "state"
+func (a Auction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		auctionJSON
+		Ativo bool `json:"active"`
+	}{
+		auctionJSON: auctionJSON(a),
+		Ativo:       a.Estado == StateActive,
+	})
+}
+
+// UnmarshalJSON também aceita o formato antigo, salvo antes da máquina de
+// estados, que só tinha as flags active/finished/cancelled
+func (a *Auction) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*auctionJSON
+		Ativo      bool `json:"active"`
+		Finalizado bool `json:"finished"`
+		Cancelado  bool `json:"cancelled"`
+	}{auctionJSON: (*auctionJSON)(a)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if a.Estado == "" {
+		switch {
+		case aux.Cancelado:
+			a.Estado = StateCancelled
+		case aux.Finalizado:
+			a.Estado = StateClosed
+		case aux.Ativo:
+			a.Estado = StateActive
+		default:
+			a.Estado = StateScheduled
+		}
+	}
+
+	return nil
+}
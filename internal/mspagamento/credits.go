@@ -0,0 +1,154 @@
+package mspagamento
+
+import (
+	"auction-system/pkg/models"
+	"auction-system/pkg/money"
+	"auction-system/pkg/rabbitmq"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// CreditPack é um pacote de créditos para os leilões de centavos
+type CreditPack struct {
+	ID      string      `json:"id"`
+	Credits int         `json:"credits"`
+	Price   money.Money `json:"price"`
+}
+
+var creditPacks = map[string]CreditPack{
+	"small":  {ID: "small", Credits: 10, Price: money.New(5_00)},
+	"medium": {ID: "medium", Credits: 50, Price: money.New(22_50)},
+	"large":  {ID: "large", Credits: 100, Price: money.New(40_00)},
+}
+
+// creditPacksHandler lista os pacotes (GET) ou inicia a compra de um deles
+// (POST). Os créditos só são liberados quando o webhook confirma o pagamento
+func (m *MsPagamento) creditPacksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		packs := make([]CreditPack, 0, len(creditPacks))
+		for _, p := range creditPacks {
+			packs = append(packs, p)
+		}
+		sort.Slice(packs, func(i, j int) bool { return packs[i].Credits < packs[j].Credits })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(packs)
+
+	case http.MethodPost:
+		var req struct {
+			UserID string `json:"user_id"`
+			Pack   string `json:"pack"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		if req.UserID == "" {
+			http.Error(w, "user_id is required", http.StatusBadRequest)
+			return
+		}
+		pack, ok := creditPacks[req.Pack]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown credit pack %q", req.Pack), http.StatusBadRequest)
+			return
+		}
+
+		payResp, err := m.BuyCredits(req.UserID, pack)
+		if err != nil {
+			log.Println("Erro ao comprar créditos:", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(payResp)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// BuyCredits guarda a compra e só então abre a cobrança do pacote no sistema
+// externo, com o ID da compra na URL do webhook: um webhook que chegue antes
+// da resposta da cobrança já encontra a compra
+func (m *MsPagamento) BuyCredits(userID string, pack CreditPack) (PaymentResponse, error) {
+	compra := CompraCreditos{
+		ID: uuid.NewString(),
+		CreditosAdquiridos: models.CreditosAdquiridos{
+			UserID:   userID,
+			Creditos: pack.Credits,
+		},
+	}
+	if err := m.compras.Save(compra); err != nil {
+		return PaymentResponse{}, fmt.Errorf("failed to save credit purchase: %w", err)
+	}
+
+	req := PaymentRequest{
+		Amount:      pack.Price,
+		Customer:    map[string]string{"id": userID},
+		CallbackURL: fmt.Sprintf("%s/payment-status?purchase_id=%s", m.publicURL, compra.ID),
+		WinnerID:    userID,
+		RequestedAt: m.clock.Now(),
+	}
+
+	payResp, err := m.requestPayment(req)
+	if err != nil {
+		if err := m.compras.Delete(compra.ID); err != nil {
+			log.Printf("Erro ao descartar a compra de créditos %s: %v", compra.ID, err)
+		}
+		return PaymentResponse{}, err
+	}
+
+	if err := m.compras.SetTransaction(compra.ID, payResp.TransactionID); err != nil {
+		log.Printf("Erro ao gravar a transação da compra de créditos %s: %v", compra.ID, err)
+	}
+
+	log.Printf("Compra de %d créditos iniciada por %s: %s", pack.Credits, userID, payResp.PaymentLink)
+	return payResp, nil
+}
+
+// settleCreditPurchase trata o webhook de uma compra de créditos e publica
+// creditos.adquiridos se o pagamento foi aprovado. Devolve false quando a
+// transação não é de créditos. purchaseID vem da URL do webhook; sem ele a
+// compra é procurada pela transação, como eram gravadas as compras antigas
+//
+// A compra só é esquecida depois da publicação: se o serviço cair no meio, o
+// webhook repetido publica de novo, e o mslance ignora a transação que já somou
+func (m *MsPagamento) settleCreditPurchase(purchaseID string, payload PaymentStatusWebhook) bool {
+	if purchaseID == "" {
+		purchaseID = payload.TransactionID
+	}
+	compra, ok := m.compras.Get(purchaseID)
+	if !ok {
+		return false
+	}
+	if compra.TransactionID != "" && compra.TransactionID != payload.TransactionID {
+		log.Printf("Webhook da transação %s não confere com a compra de créditos %s", payload.TransactionID, purchaseID)
+		return true
+	}
+	compra.TransactionID = payload.TransactionID
+
+	if payload.Status != "approved" {
+		log.Printf("Compra de créditos %s recusada", payload.TransactionID)
+	} else {
+		compra.Timestamp = m.clock.Now()
+		msgBody, _ := json.Marshal(compra.CreditosAdquiridos)
+		if err := rabbitmq.PublishToExchange(m.ch, "leilao_events", "creditos.adquiridos", msgBody); err != nil {
+			log.Println("Erro ao publicar creditos_adquiridos:", err)
+			return true
+		}
+	}
+
+	if err := m.compras.Delete(purchaseID); err != nil {
+		log.Printf("Erro ao liquidar a compra de créditos %s: %v", purchaseID, err)
+	}
+	return true
+}
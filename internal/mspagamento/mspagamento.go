@@ -1,40 +1,49 @@
 package mspagamento
 
 import (
+	"auction-system/pkg/clock"
 	"auction-system/pkg/models"
+	"auction-system/pkg/money"
 	"auction-system/pkg/rabbitmq"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type MsPagamento struct {
 	ch             *amqp.Channel
+	clock          clock.Clock
 	externalPayURL string
 	publicURL      string // usado para montar callback (ex: http://host:port)
 	queueName      string
 	httpAddr       string // endereco para expor webhook (ex ":8081")
+
+	// compras guarda os pacotes de créditos aguardando pagamento, por transação
+	compras PurchaseRepository
 }
 
 type PaymentRequest struct {
-	Amount      float64           `json:"amount"`
-	Currency    string            `json:"currency"`
+	Amount      money.Money       `json:"amount"`
+	Quantity    int               `json:"quantity,omitempty"`
 	Customer    map[string]string `json:"customer"`
 	CallbackURL string            `json:"callback_url"`
 	AuctionID   string            `json:"auction_id"`
 	WinnerID    string            `json:"winner_id"`
+	RequestedAt time.Time         `json:"requested_at"`
 }
 
 type PaymentStatusWebhook struct {
-	TransactionID string  `json:"transaction_id"`
-	Status        string  `json:"status"` // "approved" | "rejected"
-	AuctionID     string  `json:"auction_id"`
-	WinnerID      string  `json:"winner_id"`
-	Amount        float64 `json:"amount"`
+	TransactionID string      `json:"transaction_id"`
+	Status        string      `json:"status"` // "approved" | "rejected"
+	AuctionID     string      `json:"auction_id"`
+	WinnerID      string      `json:"winner_id"`
+	Amount        money.Money `json:"amount"`
 }
 
 type PaymentResponse struct {
@@ -42,13 +51,15 @@ type PaymentResponse struct {
 	TransactionID string `json:"transaction_id"`
 }
 
-func NewMsPagamento(ch *amqp.Channel, externalPayURL, publicURL, queueName, httpAddr string) *MsPagamento {
+func NewMsPagamento(ch *amqp.Channel, clk clock.Clock, compras PurchaseRepository, externalPayURL, publicURL, queueName, httpAddr string) *MsPagamento {
 	return &MsPagamento{
 		ch:             ch,
+		clock:          clk,
 		externalPayURL: externalPayURL,
 		publicURL:      publicURL,
 		queueName:      queueName,
 		httpAddr:       httpAddr,
+		compras:        compras,
 	}
 }
 
@@ -77,6 +88,19 @@ func (m *MsPagamento) ListenLeilaoVencedor() {
 			}
 
 			log.Printf("[MS PAGAMENTO] Recebido vencedor: %+v", leilao)
+
+			// leilão sem lances não tem quem pagar; leilões abaixo da reserva nem
+			// chegam aqui, o mslance publica leilao.reserva_nao_atingida no lugar
+			if leilao.UserID == "" {
+				log.Printf("[MS PAGAMENTO] Leilão %s sem vencedor, nenhum pagamento gerado", leilao.LeilaoID)
+				continue
+			}
+			if leilao.Repasse() {
+				if err := m.RegisterPayout(leilao); err != nil {
+					log.Println("Erro ao registrar repasse:", err)
+				}
+				continue
+			}
 			if err := m.SubmitPaymentData(leilao); err != nil {
 				log.Println("Erro ao enviar pagamento:", err)
 			}
@@ -86,30 +110,19 @@ func (m *MsPagamento) ListenLeilaoVencedor() {
 
 func (m *MsPagamento) SubmitPaymentData(leilao models.LeilaoVencedor) error {
 	req := PaymentRequest{
-		Amount:      leilao.Valor,
-		Currency:    "BRL",
+		Amount:      leilao.Total(),
+		Quantity:    leilao.Quantidade,
 		Customer:    map[string]string{"id": leilao.UserID},
 		CallbackURL: fmt.Sprintf("%s/payment-status", m.publicURL),
 		AuctionID:   leilao.LeilaoID,
 		WinnerID:    leilao.UserID,
+		RequestedAt: m.clock.Now(),
 		//LinkCB:      fmt.Sprintf("%s/payment-link", m.publicURL),
 	}
 
-	body, _ := json.Marshal(req)
-	url := fmt.Sprintf("%s/payment", m.externalPayURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
+	payResp, err := m.requestPayment(req)
 	if err != nil {
-		return fmt.Errorf("erro ao chamar sistema de pagamento: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("erro no retorno do sistema externo: %s", resp.Status)
-	}
-
-	var payResp PaymentResponse
-	if err := json.NewDecoder(resp.Body).Decode(&payResp); err != nil {
-		return fmt.Errorf("erro ao decodificar resposta: %w", err)
+		return err
 	}
 
 	var linkPagamento = models.LinkPagamento{
@@ -129,6 +142,47 @@ func (m *MsPagamento) SubmitPaymentData(leilao models.LeilaoVencedor) error {
 	return nil
 }
 
+// RegisterPayout registra o valor devido ao fornecedor que venceu um leilão
+// reverso. Nada é cobrado do vencedor, então o sistema externo não é chamado
+func (m *MsPagamento) RegisterPayout(leilao models.LeilaoVencedor) error {
+	repasse := models.RepassePendente{
+		ID:         uuid.NewString(),
+		LeilaoID:   leilao.LeilaoID,
+		SupplierID: leilao.UserID,
+		Amount:     leilao.Total(),
+		Timestamp:  m.clock.Now(),
+	}
+
+	msgBody, _ := json.Marshal(repasse)
+	if err := rabbitmq.PublishToExchange(m.ch, "leilao_events", "repasse.pendente", msgBody); err != nil {
+		return fmt.Errorf("erro ao publicar repasse_pendente: %w", err)
+	}
+
+	log.Printf("Repasse de %s registrado para %s (leilão %s)", repasse.Amount, repasse.SupplierID, repasse.LeilaoID)
+	return nil
+}
+
+// requestPayment abre a transação no sistema externo e devolve o link de pagamento
+func (m *MsPagamento) requestPayment(req PaymentRequest) (PaymentResponse, error) {
+	body, _ := json.Marshal(req)
+	url := fmt.Sprintf("%s/payment", m.externalPayURL)
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return PaymentResponse{}, fmt.Errorf("erro ao chamar sistema de pagamento: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return PaymentResponse{}, fmt.Errorf("erro no retorno do sistema externo: %s", resp.Status)
+	}
+
+	var payResp PaymentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&payResp); err != nil {
+		return PaymentResponse{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
+	}
+	return payResp, nil
+}
+
 func (m *MsPagamento) webhookHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Entrou no webhookHandler")
 	var payload PaymentStatusWebhook
@@ -140,6 +194,12 @@ func (m *MsPagamento) webhookHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("[WEBHOOK] Status recebido: %+v", payload)
 
+	if m.settleCreditPurchase(r.URL.Query().Get("purchase_id"), payload) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Webhook received"))
+		return
+	}
+
 	var statusPagamento = models.StatusPagamento{
 		TransactionID: payload.TransactionID,
 		Status:        payload.Status,
@@ -188,6 +248,7 @@ func (m *MsPagamento) Start() {
 	// }()
 
 	http.HandleFunc("/payment-status", m.webhookHandler)
+	http.HandleFunc("/credit-packs", m.creditPacksHandler)
 	//http.HandleFunc("/payment-link", m.paymentLinkHandler)
 	log.Printf("[MS PAGAMENTO] Servidor ouvindo webhook em %s", m.httpAddr)
 	http.ListenAndServe(m.httpAddr, nil)
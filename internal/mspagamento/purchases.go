@@ -0,0 +1,216 @@
+package mspagamento
+
+import (
+	"auction-system/pkg/models"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CompraCreditos é uma compra de créditos aguardando o webhook. O ID é gerado
+// aqui antes da cobrança e volta na URL do webhook; o TransactionID só existe
+// depois que o sistema externo responde
+type CompraCreditos struct {
+	ID string `json:"id"`
+	models.CreditosAdquiridos
+}
+
+// PurchaseRepository guarda as compras de créditos que aguardam o webhook do
+// pagamento, para que um restart entre a cobrança e a confirmação não perca
+// os créditos
+type PurchaseRepository interface {
+	Save(compra CompraCreditos) error
+	Get(id string) (CompraCreditos, bool)
+	// SetTransaction liga a compra à transação do sistema externo. Não faz
+	// nada se o webhook já tiver liquidado a compra
+	SetTransaction(id, transactionID string) error
+	// Delete esquece a compra depois que o webhook foi tratado
+	Delete(id string) error
+}
+
+// registroCompra é uma linha do arquivo: uma compra aberta ou o fim de uma
+type registroCompra struct {
+	Compra    *CompraCreditos `json:"compra,omitempty"`
+	Liquidada string          `json:"liquidada,omitempty"`
+}
+
+// minCompactLines é o tamanho do log abaixo do qual nunca vale a pena compactar
+const minCompactLines = 1024
+
+// FilePurchaseRepository mantém as compras pendentes em memória e acrescenta
+// cada compra aberta ou liquidada a um arquivo JSON Lines. O arquivo é
+// compactado para só as compras pendentes ao abrir e sempre que o log passa
+// do dobro delas
+type FilePurchaseRepository struct {
+	path      string
+	mu        sync.Mutex
+	file      *os.File
+	pendentes map[string]CompraCreditos
+	// lines é quantas linhas o arquivo tem desde a última compactação
+	lines int
+}
+
+func NewFilePurchaseRepository(path string) (*FilePurchaseRepository, error) {
+	repo := &FilePurchaseRepository{
+		path:      path,
+		pendentes: make(map[string]CompraCreditos),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec registroCompra
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				// uma linha cortada por um crash no meio da escrita é descartada
+				continue
+			}
+			repo.aplicar(rec)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+	}
+
+	if err := repo.compact(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (r *FilePurchaseRepository) aplicar(rec registroCompra) {
+	if rec.Compra != nil {
+		compra := *rec.Compra
+		if compra.ID == "" {
+			// compras gravadas antes do ID eram identificadas pela transação
+			compra.ID = compra.TransactionID
+		}
+		r.pendentes[compra.ID] = compra
+	}
+	if rec.Liquidada != "" {
+		delete(r.pendentes, rec.Liquidada)
+	}
+}
+
+func (r *FilePurchaseRepository) Save(compra CompraCreditos) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.gravar(registroCompra{Compra: &compra})
+}
+
+func (r *FilePurchaseRepository) Get(id string) (CompraCreditos, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	compra, ok := r.pendentes[id]
+	return compra, ok
+}
+
+func (r *FilePurchaseRepository) SetTransaction(id, transactionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	compra, ok := r.pendentes[id]
+	if !ok {
+		return nil
+	}
+	compra.TransactionID = transactionID
+	return r.gravar(registroCompra{Compra: &compra})
+}
+
+func (r *FilePurchaseRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.gravar(registroCompra{Liquidada: id})
+}
+
+// gravar acrescenta o registro ao arquivo e o aplica. Deve ser chamada com
+// r.mu travado
+func (r *FilePurchaseRepository) gravar(rec registroCompra) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode purchase: %w", err)
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write purchase: %w", err)
+	}
+	if err := r.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync purchases: %w", err)
+	}
+
+	r.aplicar(rec)
+	r.lines++
+
+	if r.lines > max(2*len(r.pendentes), minCompactLines) {
+		return r.compact()
+	}
+	return nil
+}
+
+func (r *FilePurchaseRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// compact regrava o arquivo só com as compras pendentes em um arquivo
+// temporário renomeado no fim, como o repositório do msleilao. Deve ser
+// chamada com r.mu travado
+func (r *FilePurchaseRepository) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, compra := range r.pendentes {
+		if err := enc.Encode(registroCompra{Compra: &compra}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to encode purchases: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write purchases: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync purchases: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", r.path, err)
+	}
+
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", r.path, err)
+	}
+	if r.file != nil {
+		r.file.Close()
+	}
+	r.file = f
+	r.lines = len(r.pendentes)
+	return nil
+}
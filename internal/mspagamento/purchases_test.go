@@ -0,0 +1,89 @@
+package mspagamento
+
+import (
+	"auction-system/pkg/clock"
+	"auction-system/pkg/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilePurchaseRepositoryReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "purchases.jsonl")
+
+	repo, err := NewFilePurchaseRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"c1", "c2"} {
+		compra := CompraCreditos{ID: id, CreditosAdquiridos: models.CreditosAdquiridos{UserID: "u1", Creditos: 10}}
+		if err := repo.Save(compra); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SetTransaction("c2", "tx2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("c1"); err != nil {
+		t.Fatal(err)
+	}
+	// a transação que chega depois do webhook não traz a compra de volta
+	if err := repo.SetTransaction("c1", "tx1"); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	repo, err = NewFilePurchaseRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	if _, ok := repo.Get("c1"); ok {
+		t.Error("settled purchase c1 came back after reopening")
+	}
+	compra, ok := repo.Get("c2")
+	if !ok || compra.UserID != "u1" || compra.Creditos != 10 || compra.TransactionID != "tx2" {
+		t.Errorf("Get(c2) = %+v, %v, want the pending purchase with its transaction", compra, ok)
+	}
+}
+
+// O sistema externo pode chamar o webhook antes de responder a cobrança; a
+// compra já tem de estar gravada e não pode voltar a ficar pendente depois
+func TestWebhookBeforePaymentResponse(t *testing.T) {
+	repo, err := NewFilePurchaseRepository(filepath.Join(t.TempDir(), "purchases.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	m := NewMsPagamento(nil, clock.NewFake(time.Now()), repo, "", "http://mspagamento", "", "")
+
+	psp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PaymentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		body, _ := json.Marshal(PaymentStatusWebhook{TransactionID: "tx-1", Status: "rejected", WinnerID: req.WinnerID})
+		webhook := httptest.NewRequest(http.MethodPost, req.CallbackURL, bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		m.webhookHandler(rec, webhook)
+		if rec.Code != http.StatusOK {
+			t.Errorf("webhook = %d, want 200", rec.Code)
+		}
+
+		json.NewEncoder(w).Encode(PaymentResponse{TransactionID: "tx-1"})
+	}))
+	defer psp.Close()
+	m.externalPayURL = psp.URL
+
+	if _, err := m.BuyCredits("u1", creditPacks["small"]); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(repo.pendentes); n != 0 {
+		t.Errorf("%d purchases still pending after the webhook, want 0", n)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"auction-system/pkg/money"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -14,8 +15,7 @@ import (
 // Structs
 
 type PaymentRequest struct {
-	Amount      float64           `json:"amount"`
-	Currency    string            `json:"currency"`
+	Amount      money.Money       `json:"amount"`
 	Customer    map[string]string `json:"customer"`
 	CallbackURL string            `json:"callback_url"`
 	AuctionID   string            `json:"auction_id"`
@@ -28,11 +28,11 @@ type PaymentResponse struct {
 }
 
 type PaymentStatusWebhook struct {
-	TransactionID string  `json:"transaction_id"`
-	Status        string  `json:"status"`
-	AuctionID     string  `json:"auction_id"`
-	WinnerID      string  `json:"winner_id"`
-	Amount        float64 `json:"amount"`
+	TransactionID string      `json:"transaction_id"`
+	Status        string      `json:"status"`
+	AuctionID     string      `json:"auction_id"`
+	WinnerID      string      `json:"winner_id"`
+	Amount        money.Money `json:"amount"`
 }
 
 type PaymentStore struct {
@@ -108,7 +108,7 @@ func handlePayment(ps *PaymentStore) http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 
-		log.Printf("[PAGEXTERNO] Nova transação %s criada (%.2f %s) \n%s", txID, req.Amount, req.Currency, paymentLink)
+		log.Printf("[PAGEXTERNO] Nova transação %s criada (%s) \n%s", txID, req.Amount, paymentLink)
 	}
 }
 
@@ -126,7 +126,7 @@ func handlePaymentPage(ps *PaymentStore) http.HandlerFunc {
 		<head><title>Pagamento {{.TxID}}</title></head>
 		<body style="font-family:sans-serif; text-align:center; margin-top:40px;">
 			<h2>Pagamento do Leilão {{.AuctionID}}</h2>
-			<p><b>Valor:</b> R$ {{printf "%.2f" .Amount}}</p>
+			<p><b>Valor:</b> {{.Amount}}</p>
 			<p><b>Cliente:</b> {{.WinnerID}}</p>
 			<form action="/complete/{{.TxID}}" method="POST" style="margin-top:20px;">
 				<button name="status" value="approved" style="padding:10px 20px; background:green; color:white; border:none;">Pagar</button>
@@ -0,0 +1,138 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstrai a passagem do tempo para que os serviços possam ser testados
+// com um relógio controlado
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type realClock struct{}
+
+// New devolve o relógio do sistema
+func New() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{t: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r *realTimer) C() <-chan time.Time        { return r.t.C }
+func (r *realTimer) Stop() bool                 { return r.t.Stop() }
+func (r *realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+// Fake é um relógio que só anda quando Advance ou Set são chamados. Timers
+// disparam no momento em que o relógio passa do seu prazo
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now:    now,
+		timers: make(map[*fakeTimer]struct{}),
+	}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{clock: f, ch: make(chan time.Time, 1)}
+	f.arm(t, d)
+	return t
+}
+
+// Advance anda o relógio d para frente, disparando os timers vencidos
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(f.now.Add(d))
+}
+
+// Set move o relógio para t. Voltar no tempo não dispara nenhum timer
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(t)
+}
+
+func (f *Fake) setLocked(t time.Time) {
+	f.now = t
+	for timer := range f.timers {
+		if !timer.deadline.After(f.now) {
+			delete(f.timers, timer)
+			select {
+			case timer.ch <- f.now:
+			default:
+			}
+		}
+	}
+}
+
+func (f *Fake) arm(t *fakeTimer, d time.Duration) {
+	t.deadline = f.now.Add(d)
+	if d <= 0 {
+		select {
+		case t.ch <- f.now:
+		default:
+		}
+		return
+	}
+	f.timers[t] = struct{}{}
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	ch       chan time.Time
+	deadline time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	t.clock.arm(t, d)
+	return active
+}
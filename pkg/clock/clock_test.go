@@ -0,0 +1,64 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func fired(t Timer) bool {
+	select {
+	case <-t.C():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := NewFake(start)
+
+	timer := clk.NewTimer(time.Minute)
+	clk.Advance(59 * time.Second)
+	if fired(timer) {
+		t.Fatal("timer fired before its deadline")
+	}
+
+	clk.Advance(time.Second)
+	if !fired(timer) {
+		t.Fatal("timer did not fire at its deadline")
+	}
+	if timer.Stop() {
+		t.Error("Stop() = true for a timer that already fired")
+	}
+
+	if timer.Reset(time.Minute) {
+		t.Error("Reset() = true for a stopped timer")
+	}
+	if !timer.Stop() {
+		t.Error("Stop() = false for an armed timer")
+	}
+	clk.Advance(time.Hour)
+	if fired(timer) {
+		t.Error("stopped timer fired")
+	}
+
+	if got := clk.Now(); !got.Equal(start.Add(time.Hour + time.Minute)) {
+		t.Errorf("Now() = %s, want %s", got, start.Add(time.Hour+time.Minute))
+	}
+}
+
+func TestFakeSetBackwardsDoesNotFire(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := NewFake(start)
+
+	timer := clk.NewTimer(time.Minute)
+	clk.Set(start.Add(-time.Hour))
+	if fired(timer) {
+		t.Fatal("timer fired when the clock moved backwards")
+	}
+	clk.Set(start.Add(time.Minute))
+	if !fired(timer) {
+		t.Fatal("timer did not fire once the clock reached its deadline")
+	}
+}
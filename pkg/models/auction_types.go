@@ -0,0 +1,85 @@
+package models
+
+import (
+	"auction-system/pkg/money"
+	"fmt"
+)
+
+type AuctionType string
+
+const (
+	AuctionEnglish AuctionType = "english"
+	AuctionDutch   AuctionType = "dutch"
+	// nos leilões selados cada participante dá um lance confidencial; no
+	// primeiro preço o vencedor paga o próprio lance e no Vickrey paga o segundo maior
+	AuctionSealedFirstPrice AuctionType = "sealed_first_price"
+	AuctionVickrey          AuctionType = "vickrey"
+	// no leilão reverso fornecedores disputam para baixo, partindo de um preço
+	// teto, e vence o menor lance
+	AuctionReverse AuctionType = "reverse"
+	// no leilão de centavos cada lance custa um crédito pré-pago, sobe o preço
+	// num valor fixo e devolve o relógio para alguns segundos
+	AuctionPenny AuctionType = "penny"
+)
+
+// Normalize trata o tipo vazio, usado antes da existência do campo, como inglês
+func (t AuctionType) Normalize() AuctionType {
+	if t == "" {
+		return AuctionEnglish
+	}
+	return t
+}
+
+func (t AuctionType) Valid() bool {
+	switch t.Normalize() {
+	case AuctionEnglish, AuctionDutch, AuctionSealedFirstPrice, AuctionVickrey, AuctionReverse, AuctionPenny:
+		return true
+	}
+	return false
+}
+
+func (t AuctionType) Sealed() bool {
+	return t == AuctionSealedFirstPrice || t == AuctionVickrey
+}
+
+// DutchParams descreve a queda de preço de um leilão holandês: começa em
+// StartPrice e cai Step a cada Interval segundos até FloorPrice
+type DutchParams struct {
+	StartPrice money.Money `json:"start_price"`
+	FloorPrice money.Money `json:"floor_price"`
+	Step       money.Money `json:"step"`
+	Interval   int         `json:"interval"`
+}
+
+func (d DutchParams) Validate() error {
+	if d.FloorPrice.IsNegative() {
+		return fmt.Errorf("dutch floor price cannot be negative")
+	}
+	if !d.StartPrice.GreaterThan(d.FloorPrice) {
+		return fmt.Errorf("dutch start price must be above the floor price")
+	}
+	if !d.Step.IsPositive() {
+		return fmt.Errorf("dutch step must be positive")
+	}
+	if d.Interval <= 0 {
+		return fmt.Errorf("dutch interval must be positive")
+	}
+	return nil
+}
+
+// PennyParams descreve o leilão de centavos: cada lance sobe o preço em
+// Increment e garante ao menos Timer segundos até o fim
+type PennyParams struct {
+	Increment money.Money `json:"increment"`
+	Timer     int         `json:"timer"`
+}
+
+func (p PennyParams) Validate() error {
+	if !p.Increment.IsPositive() {
+		return fmt.Errorf("penny increment must be positive")
+	}
+	if p.Timer <= 0 {
+		return fmt.Errorf("penny timer must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"auction-system/pkg/money"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// BidRequest é o corpo do lance enviado pelo cliente, aceito tanto pelo
+// mslance (HTTP) quanto pelo gateway (fila lance_realizado)
+type BidRequest struct {
+	BidID    string `json:"bid_id"`
+	UserID   string `json:"user_id"`
+	LeilaoID string `json:"leilao_id"`
+	// os valores aceitam o formato do money.Money e também o decimal em
+	// string que o frontend enviava antes dele
+	Valor *money.Money `json:"valor"`
+	// lance máximo opcional para o lance automático
+	ValorMaximo *money.Money `json:"valor_maximo"`
+	// unidades desejadas nos leilões de várias unidades
+	Quantidade string `json:"quantidade"`
+}
+
+// Lance valida o pedido e monta o LanceRealizado. O bid_id pode vir no corpo
+// ou no cabeçalho Idempotency-Key, passado em idempotencyKey
+func (r BidRequest) Lance(idempotencyKey string) (LanceRealizado, error) {
+	if err := ValidateAuctionID(r.LeilaoID); err != nil {
+		return LanceRealizado{}, err
+	}
+
+	for _, v := range []*money.Money{r.Valor, r.ValorMaximo} {
+		if v != nil && v.Currency != money.DefaultCurrency {
+			return LanceRealizado{}, fmt.Errorf("currency must be %s", money.DefaultCurrency)
+		}
+	}
+
+	var maxNum money.Money
+	if r.ValorMaximo != nil {
+		if !r.ValorMaximo.IsPositive() {
+			return LanceRealizado{}, errors.New("max value must be a positive number")
+		}
+		maxNum = *r.ValorMaximo
+	}
+
+	var valueNum money.Money
+	if r.Valor != nil {
+		valueNum = *r.Valor
+	} else if maxNum.IsZero() {
+		return LanceRealizado{}, errors.New("value is required")
+	}
+
+	quantidade := 1
+	if r.Quantidade != "" {
+		q, err := strconv.Atoi(r.Quantidade)
+		if err != nil || q <= 0 {
+			return LanceRealizado{}, errors.New("quantity must be a positive integer")
+		}
+		quantidade = q
+	}
+
+	bidID := r.BidID
+	if bidID == "" {
+		bidID = idempotencyKey
+	}
+
+	return LanceRealizado{
+		BidID:       bidID,
+		UserID:      r.UserID,
+		LeilaoID:    r.LeilaoID,
+		Valor:       valueNum,
+		ValorMaximo: maxNum,
+		Quantidade:  quantidade,
+	}, nil
+}
+
+// CodigoRejeicao identifica, de forma estável para os clientes, a regra que
+// recusou um lance
+type CodigoRejeicao string
+
+const (
+	RejeicaoLeilaoCancelado    CodigoRejeicao = "auction_cancelled"
+	RejeicaoLeilaoInativo      CodigoRejeicao = "auction_not_active"
+	RejeicaoUsuarioBloqueado   CodigoRejeicao = "user_blocked"
+	RejeicaoVendedor           CodigoRejeicao = "seller_cannot_bid"
+	RejeicaoLimiteLances       CodigoRejeicao = "bid_limit_reached"
+	RejeicaoLanceAutomatico    CodigoRejeicao = "proxy_not_allowed"
+	RejeicaoQuantidade         CodigoRejeicao = "quantity_exceeded"
+	RejeicaoNaoPositivo        CodigoRejeicao = "not_positive"
+	RejeicaoAbaixoMinimo       CodigoRejeicao = "below_minimum"
+	RejeicaoAcimaMaximo        CodigoRejeicao = "above_maximum"
+	RejeicaoAbaixoPreco        CodigoRejeicao = "below_current_price"
+	RejeicaoMaximoNaoAumentado CodigoRejeicao = "max_not_raised"
+	RejeicaoJaLider            CodigoRejeicao = "already_leading"
+	RejeicaoSemCreditos        CodigoRejeicao = "insufficient_credits"
+	RejeicaoSuperado           CodigoRejeicao = "outbid_by_proxy"
+	RejeicaoMoeda              CodigoRejeicao = "currency_mismatch"
+	RejeicaoCompraIndisponivel CodigoRejeicao = "buy_now_unavailable"
+)
+
+type StatusLance string
+
+const (
+	LanceAceito      StatusLance = "accepted"
+	LanceRecusado    StatusLance = "rejected"
+	LanceConflito    StatusLance = "conflict"
+	LanceEnfileirado StatusLance = "queued"
+)
+
+// ResultadoLance é a resposta do mslance a um lance recebido pela fila
+// lance_realizado, enviada para a fila indicada no reply-to com o mesmo
+// correlation id
+type ResultadoLance struct {
+	BidID    string      `json:"bid_id"`
+	LeilaoID string      `json:"leilao_id"`
+	UserID   string      `json:"user_id"`
+	Status   StatusLance `json:"status"`
+	Erro     string      `json:"error,omitempty"`
+	// Codigo vem preenchido quando uma regra recusou o lance
+	Codigo   CodigoRejeicao `json:"code,omitempty"`
+	Replayed bool           `json:"replayed,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidAuctionID = errors.New("invalid auction id")
+
+// NewAuctionID gera um UUIDv7, único entre réplicas e restarts e ordenável
+// pela data de criação
+func NewAuctionID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// ValidateAuctionID aceita apenas UUIDv7 na forma canônica, a mesma gerada por
+// NewAuctionID e usada como chave nos mapas dos serviços
+func ValidateAuctionID(id string) error {
+	if u, err := uuid.Parse(id); err != nil || u.String() != id || u.Version() != 7 {
+		return fmt.Errorf("%w %q", ErrInvalidAuctionID, id)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateAuctionID(t *testing.T) {
+	valido := NewAuctionID()
+	casos := map[string]struct {
+		id string
+		ok bool
+	}{
+		"v7":         {valido, true},
+		"v4":         {uuid.NewString(), false},
+		"uppercase":  {strings.ToUpper(valido), false},
+		"braces":     {"{" + valido + "}", false},
+		"numeric":    {"1", false},
+		"empty":      {"", false},
+		"truncated":  {valido[:len(valido)-1], false},
+		"not hex":    {"zzzzzzzz" + valido[8:], false},
+		"urn prefix": {"urn:uuid:" + valido, false},
+	}
+	for nome, c := range casos {
+		err := ValidateAuctionID(c.id)
+		if c.ok && err != nil {
+			t.Errorf("%s: ValidateAuctionID(%q) = %v, want nil", nome, c.id, err)
+		}
+		if !c.ok && !errors.Is(err, ErrInvalidAuctionID) {
+			t.Errorf("%s: ValidateAuctionID(%q) = %v, want ErrInvalidAuctionID", nome, c.id, err)
+		}
+	}
+}
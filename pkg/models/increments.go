@@ -0,0 +1,50 @@
+package models
+
+import (
+	"auction-system/pkg/money"
+	"fmt"
+)
+
+// IncrementTier define o incremento mínimo para lances abaixo de Below. Um
+// Below zero vale para qualquer valor e só pode aparecer na última faixa
+type IncrementTier struct {
+	Below money.Money `json:"below,omitzero"`
+	Step  money.Money `json:"step"`
+}
+
+type IncrementTable []IncrementTier
+
+// DefaultIncrements é usada quando o vendedor não informa uma tabela
+var DefaultIncrements = IncrementTable{
+	{Below: money.New(100_00), Step: money.New(1_00)},
+	{Below: money.New(1000_00), Step: money.New(5_00)},
+	{Step: money.New(10_00)},
+}
+
+func (t IncrementTable) Validate() error {
+	for i, tier := range t {
+		if !tier.Step.IsPositive() {
+			return fmt.Errorf("increment step must be positive")
+		}
+		if tier.Below.IsZero() && i != len(t)-1 {
+			return fmt.Errorf("only the last increment tier can be open ended")
+		}
+		if i > 0 && !tier.Below.IsZero() && !tier.Below.GreaterThan(t[i-1].Below) {
+			return fmt.Errorf("increment tiers must be in ascending order")
+		}
+	}
+	return nil
+}
+
+// StepFor devolve o incremento mínimo a partir do preço atual
+func (t IncrementTable) StepFor(price money.Money) money.Money {
+	if len(t) == 0 {
+		t = DefaultIncrements
+	}
+	for _, tier := range t {
+		if tier.Below.IsZero() || price.LessThan(tier.Below) {
+			return tier.Step
+		}
+	}
+	return t[len(t)-1].Step
+}
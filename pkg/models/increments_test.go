@@ -0,0 +1,54 @@
+package models
+
+import (
+	"auction-system/pkg/money"
+	"testing"
+)
+
+func TestStepForBandBoundaries(t *testing.T) {
+	limitada := IncrementTable{
+		{Below: money.New(50_00), Step: money.New(50)},
+		{Below: money.New(200_00), Step: money.New(2_00)},
+	}
+
+	tests := []struct {
+		name  string
+		table IncrementTable
+		price int64
+		want  int64
+	}{
+		{"default, zero", nil, 0, 1_00},
+		{"default, just below 100", nil, 99_99, 1_00},
+		{"default, at 100", nil, 100_00, 5_00},
+		{"default, just below 1000", nil, 999_99, 5_00},
+		{"default, at 1000", nil, 1000_00, 10_00},
+		{"default, far above", nil, 1_000_000_00, 10_00},
+		{"custom, just below first band", limitada, 49_99, 50},
+		{"custom, at first band", limitada, 50_00, 2_00},
+		{"custom, past the last band", limitada, 500_00, 2_00},
+	}
+	for _, tt := range tests {
+		if got := tt.table.StepFor(money.New(tt.price)); !got.Equal(money.New(tt.want)) {
+			t.Errorf("%s: StepFor(%s) = %s, want %s", tt.name, money.New(tt.price), got, money.New(tt.want))
+		}
+	}
+}
+
+func TestIncrementTableValidate(t *testing.T) {
+	tests := map[string]struct {
+		table IncrementTable
+		ok    bool
+	}{
+		"default":        {DefaultIncrements, true},
+		"single open":    {IncrementTable{{Step: money.New(1)}}, true},
+		"zero step":      {IncrementTable{{Step: money.New(0)}}, false},
+		"open in middle": {IncrementTable{{Step: money.New(1)}, {Below: money.New(100), Step: money.New(2)}}, false},
+		"descending":     {IncrementTable{{Below: money.New(100), Step: money.New(1)}, {Below: money.New(50), Step: money.New(2)}}, false},
+		"repeated band":  {IncrementTable{{Below: money.New(100), Step: money.New(1)}, {Below: money.New(100), Step: money.New(2)}}, false},
+	}
+	for name, tt := range tests {
+		if err := tt.table.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v, want ok=%v", name, err, tt.ok)
+		}
+	}
+}
@@ -1,50 +1,214 @@
 package models
 
-import "time"
+import (
+	"auction-system/pkg/money"
+	"time"
+)
 
 type LeilaoIniciado struct {
+	ID            string         `json:"id"`
+	Descricao     string         `json:"descricao"`
+	DataInicio    time.Time      `json:"data_inicio"`
+	DataFim       time.Time      `json:"data_fim"`
+	ReservePrice  money.Money    `json:"reserve_price,omitzero"`
+	StartingPrice money.Money    `json:"starting_price,omitzero"`
+	Increments    IncrementTable `json:"increments,omitempty"`
+	Tipo          AuctionType    `json:"tipo,omitempty"`
+	Dutch         *DutchParams   `json:"dutch,omitempty"`
+	Quantidade    int            `json:"quantidade,omitempty"`
+	CeilingPrice  money.Money    `json:"ceiling_price,omitzero"`
+	Penny         *PennyParams   `json:"penny,omitempty"`
+	// BuyNowPrice encerra o leilão na hora para quem aceitar pagá-lo, até que os
+	// lances cheguem a BuyNowThreshold (ou até o primeiro lance, se zero)
+	BuyNowPrice     money.Money `json:"buy_now_price,omitzero"`
+	BuyNowThreshold money.Money `json:"buy_now_threshold,omitzero"`
+	SellerID        string      `json:"seller_id,omitempty"`
+	MaxBidsPerUser  int         `json:"max_bids_per_user,omitempty"`
+	// lances dentro dos últimos SoftCloseWindow segundos estendem o fim em
+	// SoftCloseExtension segundos
+	SoftCloseWindow    int `json:"soft_close_window,omitempty"`
+	SoftCloseExtension int `json:"soft_close_extension,omitempty"`
+}
+
+// CheckCurrency recusa leilões com algum valor fora da moeda padrão, que é a
+// única aceita nos lances
+func (e LeilaoIniciado) CheckCurrency() error {
+	valores := []money.Money{e.ReservePrice, e.StartingPrice, e.CeilingPrice, e.BuyNowPrice, e.BuyNowThreshold}
+	for _, tier := range e.Increments {
+		valores = append(valores, tier.Below, tier.Step)
+	}
+	if e.Dutch != nil {
+		valores = append(valores, e.Dutch.StartPrice, e.Dutch.FloorPrice, e.Dutch.Step)
+	}
+	if e.Penny != nil {
+		valores = append(valores, e.Penny.Increment)
+	}
+	return money.CheckCurrency(money.DefaultCurrency, valores...)
+}
+
+// LeilaoAberto é um leilão que ainda espera resultado do mslance: ativo, ou
+// já finalizado aguardando o vencedor (Encerrado). O msleilao devolve essa
+// lista para o mslance se recuperar depois de um restart
+type LeilaoAberto struct {
+	LeilaoIniciado
+	Encerrado bool `json:"encerrado,omitempty"`
+	// PrecoAtual é o preço corrente do leilão holandês
+	PrecoAtual money.Money `json:"preco_atual,omitzero"`
+}
+
+type LeilaoFinalizado struct {
+	ID        string `json:"id"`
+	Descricao string `json:"descricao"`
+	// DataFim é o fim que o msleilao conhecia ao encerrar. Se o mslance já
+	// prorrogou o leilão além dele, o evento é ignorado
+	DataFim time.Time `json:"data_fim,omitzero"`
+}
+
+type LeilaoAtualizado struct {
 	ID         string    `json:"id"`
 	Descricao  string    `json:"descricao"`
 	DataInicio time.Time `json:"data_inicio"`
 	DataFim    time.Time `json:"data_fim"`
 }
 
-type LeilaoFinalizado struct {
+type LeilaoCancelado struct {
 	ID        string `json:"id"`
 	Descricao string `json:"descricao"`
 }
 
+// LeilaoProrrogado é publicado quando um lance no fim do leilão estende o prazo
+type LeilaoProrrogado struct {
+	ID      string    `json:"id"`
+	DataFim time.Time `json:"data_fim"`
+}
+
+// LeilaoPrecoAtualizado é publicado a cada queda de preço do leilão holandês
+type LeilaoPrecoAtualizado struct {
+	ID    string      `json:"id"`
+	Preco money.Money `json:"preco"`
+}
+
+type LeilaoEstadoAlterado struct {
+	ID             string    `json:"id"`
+	EstadoAnterior string    `json:"estado_anterior"`
+	Estado         string    `json:"estado"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
 type LanceRealizado struct {
-	LeilaoID string  `json:"leilao_id"`
-	UserID   string  `json:"user_id"`
-	Valor    float64 `json:"valor"`
+	// BidID é gerado pelo cliente e identifica o lance entre retentativas
+	BidID    string      `json:"bid_id,omitempty"`
+	LeilaoID string      `json:"leilao_id"`
+	UserID   string      `json:"user_id"`
+	Valor    money.Money `json:"valor"`
+	// ValorMaximo ativa o lance automático: o mslance cobre os concorrentes até esse limite
+	ValorMaximo money.Money `json:"valor_maximo,omitzero"`
+	// Quantidade é quantas unidades o lance disputa nos leilões de várias unidades
+	Quantidade int `json:"quantidade,omitempty"`
 }
 
 type LanceValidado struct {
-	LeilaoID string  `json:"leilao_id"`
-	UserID   string  `json:"user_id"`
-	Valor    float64 `json:"valor"`
+	LeilaoID string `json:"leilao_id"`
+	UserID   string `json:"user_id"`
+	// Pseudonimo é como o participante aparece para a sala do leilão
+	Pseudonimo string      `json:"pseudonimo,omitempty"`
+	Valor      money.Money `json:"valor"`
+	Quantidade int         `json:"quantidade,omitempty"`
+	Timestamp  time.Time   `json:"timestamp"`
 }
 
 type LanceInvalidado struct {
-	LeilaoID string  `json:"leilao_id"`
-	UserID   string  `json:"user_id"`
-	Valor    float64 `json:"valor"`
-	Motivo   string  `json:"motivo"`
+	LeilaoID string      `json:"leilao_id"`
+	UserID   string      `json:"user_id"`
+	Valor    money.Money `json:"valor"`
+	// Codigo identifica a regra que recusou o lance; Motivo é o texto para o usuário
+	Codigo CodigoRejeicao `json:"codigo"`
+	Motivo string         `json:"motivo"`
+}
+
+// LanceSuperado avisa quem perdeu a liderança do leilão. UserID é o
+// participante superado e Valor o lance que passou a valer
+type LanceSuperado struct {
+	LeilaoID  string      `json:"leilao_id"`
+	UserID    string      `json:"user_id"`
+	Valor     money.Money `json:"valor"`
+	Timestamp time.Time   `json:"timestamp"`
 }
 
+// DirecaoPagamento diz quem paga quem ao fim do leilão. No leilão reverso o
+// vencedor é um fornecedor e recebe em vez de pagar
+type DirecaoPagamento string
+
+const (
+	DirecaoCobranca DirecaoPagamento = "charge"
+	DirecaoRepasse  DirecaoPagamento = "payout"
+)
+
 type LeilaoVencedor struct {
-	LeilaoID string  `json:"leilao_id"`
-	UserID   string  `json:"user_id"`
-	Valor    float64 `json:"valor"`
+	LeilaoID   string      `json:"leilao_id"`
+	UserID     string      `json:"user_id"`
+	Pseudonimo string      `json:"pseudonimo,omitempty"`
+	Valor      money.Money `json:"valor"`
+	// PrecoFinal é quanto o vencedor paga. Só difere de Valor, o lance vencedor,
+	// no leilão Vickrey
+	PrecoFinal money.Money `json:"preco_final"`
+	// Quantidade e Vencedores só aparecem nos leilões de várias unidades: quantas
+	// unidades este vencedor leva e quantos vencedores o leilão teve no total
+	Quantidade int `json:"quantidade,omitempty"`
+	Vencedores int `json:"vencedores,omitempty"`
+	// Direcao vazia equivale a cobrança, como antes do leilão reverso
+	Direcao DirecaoPagamento `json:"direcao,omitempty"`
+}
+
+// Preco devolve o valor a cobrar, aceitando mensagens anteriores ao PrecoFinal
+func (v LeilaoVencedor) Preco() money.Money {
+	if v.PrecoFinal.IsPositive() {
+		return v.PrecoFinal
+	}
+	return v.Valor
+}
+
+func (v LeilaoVencedor) Repasse() bool {
+	return v.Direcao == DirecaoRepasse
+}
+
+// Total é o valor a cobrar por todas as unidades arrematadas
+func (v LeilaoVencedor) Total() money.Money {
+	return v.Preco().Mul(int64(max(v.Quantidade, 1)))
+}
+
+// LeilaoReservaNaoAtingida substitui o leilao.vencedor quando o maior lance
+// fica abaixo da reserva. O valor da reserva não é divulgado
+type LeilaoReservaNaoAtingida struct {
+	LeilaoID   string      `json:"leilao_id"`
+	UserID     string      `json:"user_id"`
+	MaiorLance money.Money `json:"maior_lance"`
+}
+
+// RepassePendente é o valor a pagar ao fornecedor que venceu um leilão reverso
+type RepassePendente struct {
+	ID         string      `json:"id"`
+	LeilaoID   string      `json:"leilao_id"`
+	SupplierID string      `json:"supplier_id"`
+	Amount     money.Money `json:"amount"`
+	Timestamp  time.Time   `json:"timestamp"`
+}
+
+// CreditosAdquiridos é publicado quando o pagamento de um pacote de créditos
+// para o leilão de centavos é aprovado
+type CreditosAdquiridos struct {
+	UserID        string    `json:"user_id"`
+	Creditos      int       `json:"creditos"`
+	TransactionID string    `json:"transaction_id"`
+	Timestamp     time.Time `json:"timestamp"`
 }
 
 type StatusPagamento struct {
-	TransactionID string  `json:"transaction_id"`
-	Status        string  `json:"status"` // "approved" | "rejected"
-	AuctionID     string  `json:"auction_id"`
-	WinnerID      string  `json:"winner_id"`
-	Amount        float64 `json:"amount"`
+	TransactionID string      `json:"transaction_id"`
+	Status        string      `json:"status"` // "approved" | "rejected"
+	AuctionID     string      `json:"auction_id"`
+	WinnerID      string      `json:"winner_id"`
+	Amount        money.Money `json:"amount"`
 }
 
 type LinkPagamento struct {
@@ -0,0 +1,233 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency é usada nos valores que chegam sem moeda, como os do
+// formato antigo em float
+const DefaultCurrency = "BRL"
+
+var (
+	ErrInvalidAmount    = errors.New("invalid money amount")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// Money é um valor exato em centavos (a menor unidade da moeda). Todas as
+// moedas aceitas têm duas casas decimais
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New cria um valor a partir dos centavos na moeda padrão
+func New(cents int64) Money {
+	return Money{Amount: cents, Currency: DefaultCurrency}
+}
+
+// FromFloat converte o formato antigo, arredondando para centavos. Serve só
+// para decodificar mensagens e arquivos gravados antes do Money
+func FromFloat(v float64) Money {
+	return New(int64(math.Round(v * 100)))
+}
+
+// Parse lê um decimal como "12", "12.5" ou "12.50" sem passar por float
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	inteiro, frac, temFrac := strings.Cut(s, ".")
+	if inteiro == "" || (temFrac && (frac == "" || len(frac) > 2)) {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	unidades, err := strconv.ParseInt(inteiro, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+	centavos, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil || strings.ContainsAny(frac, "+-") {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+	if unidades > (math.MaxInt64-centavos)/100 {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+
+	amount := unidades*100 + centavos
+	if neg {
+		amount = -amount
+	}
+	return New(amount), nil
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// match recusa contas entre moedas diferentes
+func (m Money) match(o Money) error {
+	if m.currency() != o.currency() {
+		return fmt.Errorf("%w: %s vs %s", ErrCurrencyMismatch, m.currency(), o.currency())
+	}
+	return nil
+}
+
+// CheckCurrency confere se todos os valores estão na moeda informada. Valores
+// sem moeda contam como DefaultCurrency
+func CheckCurrency(currency string, values ...Money) error {
+	for _, v := range values {
+		if v.currency() != currency {
+			return fmt.Errorf("%w: %s, expected %s", ErrCurrencyMismatch, v.currency(), currency)
+		}
+	}
+	return nil
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.match(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currency()}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.match(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currency()}, nil
+}
+
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.currency()}
+}
+
+// Cmp devolve -1, 0 ou 1 conforme m seja menor, igual ou maior que o
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.match(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// LessThan, GreaterThan e Equal são falsas entre moedas diferentes, que não
+// têm ordem entre si. Quem precisa distinguir o caso usa Cmp
+func (m Money) LessThan(o Money) bool {
+	c, err := m.Cmp(o)
+	return err == nil && c < 0
+}
+
+func (m Money) GreaterThan(o Money) bool {
+	c, err := m.Cmp(o)
+	return err == nil && c > 0
+}
+
+func (m Money) Equal(o Money) bool {
+	c, err := m.Cmp(o)
+	return err == nil && c == 0
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// Max e Min devolvem a quando os valores estão em moedas diferentes
+func Max(a, b Money) Money {
+	if a.LessThan(b) {
+		return b
+	}
+	return a
+}
+
+func Min(a, b Money) Money {
+	if b.LessThan(a) {
+		return b
+	}
+	return a
+}
+
+// Decimal formata só o número, como "1234.50"
+func (m Money) Decimal() string {
+	amount := m.Amount
+	sinal := ""
+	if amount < 0 {
+		sinal = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sinal, amount/100, amount%100)
+}
+
+// String formata com a moeda, como "1234.50 BRL"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.currency()
+}
+
+type moneyJSON struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON grava {"amount": centavos, "currency": "BRL"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Amount, Currency: m.currency()})
+}
+
+// UnmarshalJSON aceita o formato novo e também os usados antes do Money: um
+// número em reais (float) ou um decimal em string, como o frontend enviava
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*m = Money{}
+		return nil
+
+	case bytes.HasPrefix(data, []byte("{")):
+		var aux moneyJSON
+		if err := json.Unmarshal(data, &aux); err != nil {
+			return err
+		}
+		*m = Money{Amount: aux.Amount, Currency: aux.Currency}
+		if m.Currency == "" {
+			m.Currency = DefaultCurrency
+		}
+		return nil
+
+	case bytes.HasPrefix(data, []byte(`"`)):
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		v, err := Parse(s)
+		if err != nil {
+			return err
+		}
+		*m = v
+		return nil
+	}
+
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%w %s", ErrInvalidAmount, data)
+	}
+	*m = FromFloat(f)
+	return nil
+}
@@ -0,0 +1,105 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	casos := map[string]int64{
+		"12":      12_00,
+		"12.5":    12_50,
+		"12.50":   12_50,
+		" 0.01 ":  1,
+		"-3.25":   -3_25,
+		"1000000": 1000000_00,
+	}
+	for s, want := range casos {
+		got, err := Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", s, err)
+			continue
+		}
+		if got != New(want) {
+			t.Errorf("Parse(%q) = %v, want %v", s, got, New(want))
+		}
+	}
+
+	for _, s := range []string{"", ".5", "1.", "1.234", "1.-5", "1.+5", "abc", "92233720368547758.08"} {
+		if _, err := Parse(s); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Parse(%q) = %v, want ErrInvalidAmount", s, err)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	casos := map[string]Money{
+		`{"amount": 1250, "currency": "USD"}`: {Amount: 12_50, Currency: "USD"},
+		`{"amount": 1250}`:                    New(12_50),
+		`"12.50"`:                             New(12_50),
+		`12.5`:                                New(12_50),
+		`0.1`:                                 New(10),
+		`null`:                                {},
+	}
+	for data, want := range casos {
+		var got Money
+		if err := json.Unmarshal([]byte(data), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", data, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Unmarshal(%s) = %#v, want %#v", data, got, want)
+		}
+	}
+
+	for _, data := range []string{`"1.234"`, `true`, `{"amount": "x"}`} {
+		var m Money
+		if err := json.Unmarshal([]byte(data), &m); err == nil {
+			t.Errorf("Unmarshal(%s) = %v, want error", data, m)
+		}
+	}
+}
+
+func TestMarshalJSONRoundTrip(t *testing.T) {
+	in := Money{Amount: 1234_56, Currency: "BRL"}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":123456,"currency":"BRL"}` {
+		t.Errorf("Marshal = %s", data)
+	}
+	var out Money
+	if err := json.Unmarshal(data, &out); err != nil || out != in {
+		t.Errorf("round trip = %v, %v", out, err)
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	brl := New(10_00)
+	usd := Money{Amount: 5_00, Currency: "USD"}
+
+	if _, err := brl.Add(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := brl.Sub(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Sub = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := brl.Cmp(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Cmp = %v, want ErrCurrencyMismatch", err)
+	}
+	if brl.LessThan(usd) || brl.GreaterThan(usd) || brl.Equal(usd) {
+		t.Error("valores em moedas diferentes não deveriam ser comparáveis")
+	}
+	if got := Max(brl, usd); got != brl {
+		t.Errorf("Max = %v, want %v", got, brl)
+	}
+
+	if soma, err := brl.Add(Money{Amount: 1}); err != nil || soma != New(10_01) {
+		t.Errorf("Add sem moeda = %v, %v, want 10.01 BRL", soma, err)
+	}
+	if err := CheckCurrency(DefaultCurrency, brl, Money{}, usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("CheckCurrency = %v, want ErrCurrencyMismatch", err)
+	}
+}
@@ -110,3 +110,24 @@ func PublishToExchange(ch *amqp.Channel, exchange string, key string, body []byt
 
 	return nil
 }
+
+// Reply responde um pedido request-reply: publica direto na fila do reply-to
+// com o mesmo correlation id do pedido
+func Reply(ch *amqp.Channel, replyTo string, correlationID string, body []byte) error {
+	err := ch.Publish(
+		"",
+		replyTo,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: correlationID,
+			Body:          body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reply to %s: %w", replyTo, err)
+	}
+
+	return nil
+}